@@ -17,41 +17,153 @@ package mabvm
 import (
 	"errors"
 	"io"
+	"io/fs"
+	"math"
 	"strconv"
-	"strings"
 )
 
 type AsmParser struct {
 	src string
 	pos int
 
-	line int
+	// line - current line, start - position of current item.
+	line  int
+	start int
+
+	// file - name of source file, it is empty for source given as string.
+	file string
+
+	// site - prefix of errors, which locates macro call.
+	site string
+
+	// locals - names of labels local to macro expansion.
+	locals map[string]string
+
+	st *asmState
+}
+
+// asmState - labels, constants, macros and fixups shared by parser and its macro expansions.
+type asmState struct {
+	labels map[string]label
+	consts map[string]*expr
+	macros map[string]*macro
+	fixups []fixup
+	errs   ErrorList
+
+	// order - names of labels in order of definition.
+	order []string
+	smap  *SourceMap
+
+	// fsys, includes - file system of included files and stack of files being parsed.
+	fsys     fs.FS
+	includes []string
+
+	// expansions, items - numbers of macro calls and of items parsed in their bodies, which are limited by
+	// maxMacroExpansions and maxMacroItems.
+	expansions int
+	items      int
+	depth      int
+}
+
+// exhausted - reports whether macro expansions exceeded their budget.
+func (st *asmState) exhausted() bool {
+	return st.expansions > maxMacroExpansions || st.items > maxMacroItems
+}
+
+// label - code and data indices at label definition.
+type label struct {
+	code  Word
+	data  Word
+	where string
+}
+
+func (l label) index(data bool) Word {
+	if data {
+		return l.data
+	}
+
+	return l.code
+}
+
+// fixup - data word which refers to labels defined after it.
+// At is error located at it, which message is set if it is not resolved.
+type fixup struct {
+	index int
+	expr  *expr
+	at    *AsmError
 }
 
 func NewAsmParser(src string) AsmParser {
 	return AsmParser{src: src}
 }
 
+// Parse - parses source into machine code and data in two passes.
+// First pass emits code and data and collects labels, second pass resolves references to labels.
+// Parser recovers from error at next whitespace, so every error is reported in returned ErrorList.
 func (ap *AsmParser) Parse(mac *Machine) error {
 	if mac == nil {
 		return errors.New("machine should not be nil")
 	}
 
-	for {
-		switch err := ap.parseOpcodeOrNumber(mac); err {
+	st := ap.state()
+
+	if st.smap == nil {
+		st.smap = &SourceMap{
+			Code: make([]SourceLoc, len(mac.code)),
+			Data: make([]SourceLoc, len(mac.data)),
+		}
+	}
+
+	ap.parseAll(mac)
+	ap.resolve(mac)
+
+	errs := st.errs
+	st.errs = nil
+
+	return errs.Err()
+}
+
+// parseAll - parses source till EOF, recording errors and recovering at next whitespace.
+func (ap *AsmParser) parseAll(mac *Machine) {
+	st := ap.state()
+
+	for len(st.errs) < maxErrors && (st.depth == 0 || !st.exhausted()) {
+		err := ap.parseOpcodeOrNumber(mac)
+		if st.smap != nil {
+			ap.record(mac)
+		}
+
+		if err != io.EOF && st.depth > 0 {
+			st.items++
+		}
+
+		switch err {
 		case nil:
 		case io.EOF:
-			return nil
+			return
 		default:
-			return err
+			st.errs.add(err)
+			ap.skipToken()
 		}
 	}
 }
 
 func (ap *AsmParser) parseOpcodeOrNumber(mac *Machine) (err error) {
 	ap.skipWhitespaces()
+	ap.start = ap.pos
 
-	if ap.currentCharacter() != ':' {
+	switch cc := ap.currentCharacter(); {
+	case cc == '@' || cc == '&':
+		return ap.parseReference(mac)
+	case cc == '(' || cc == '\'':
+		return ap.parseExprItem(mac)
+	case cc == '"':
+		return ap.parseString(mac)
+	case cc == '.':
+		return ap.parseDirective(mac)
+	case isIdentifierStart(cc):
+		return ap.parseLabel(mac)
+	case cc != ':':
 		return ap.parseNumber(mac)
 	}
 
@@ -69,7 +181,7 @@ func (ap *AsmParser) parseOpcodeOrNumber(mac *Machine) (err error) {
 	case 'V':
 		op = VJ
 	default:
-		return ap.buildError("character", "sequence-jump ('S' | 'D' | 'C' | 'V')")
+		return ap.buildError("'S'", "'D'", "'C'", "'V'")
 	}
 
 	ap.iterateCharacter()
@@ -96,7 +208,11 @@ func (ap *AsmParser) parseOpcodeOrNumber(mac *Machine) (err error) {
 
 fini:
 	if cc := ap.currentCharacter(); !isVoid(cc) {
-		return ap.buildError("character sequence", "flag sequence ('I' - 'E' - 'M' - 'L' - 'E' - 'G')")
+		return ap.buildError("flag sequence ('I' - 'E' - 'M' - 'L' - 'E' - 'G')")
+	}
+
+	if len(mac.code) >= maxCodeLen {
+		return ap.buildLineError("code exceeds limit of " + strconv.Itoa(maxCodeLen) + " instructions")
 	}
 
 	mac.code = append(mac.code, op)
@@ -104,80 +220,388 @@ fini:
 }
 
 func (ap *AsmParser) parseNumber(mac *Machine) (err error) {
-	sign := int64(1)
+	sign := ap.currentCharacter()
 
-	switch ap.currentCharacter() {
-	case '+':
-	case '-':
-		sign = -1
+	switch sign {
+	case '+', '-', '~':
 	case ';':
 		ap.skipComment()
 		return nil
 	case '\x00':
 		return io.EOF
 	default:
-		return ap.buildError("character", "sign ('+' | '-')")
+		return ap.buildError("'+'", "'-'", "'~'")
 	}
 
 	ap.iterateCharacter()
 
-	base := int64(0)
+	base := baseOf(ap.currentCharacter())
 
-	switch ap.currentCharacter() {
-	case 'b':
-		base = 2
-	case 'o':
-		base = 8
-	case 'd':
-		base = 10
-	case 'h':
-		base = 16
-	case '\x00':
-		return ap.buildError("EOF", "base ('b' | 'o' | 'd' | 'h')")
-	default:
-		return ap.buildError("character", "base ('b' | 'o' | 'd' | 'h')")
+	if base == 0 {
+		return ap.buildError("'b'", "'o'", "'d'", "'h'")
 	}
 
 	ap.iterateCharacter()
 
-	word := ap.parseNumberABS(base)
+	word, err := ap.parseSigned(sign, base)
+	if err != nil {
+		return err
+	}
 
 	switch cc := ap.currentCharacter(); {
 	case isVoid(cc):
-		mac.data = append(mac.data, word*sign)
+		if err := ap.checkData(mac, 1); err != nil {
+			return err
+		}
+
+		mac.data = append(mac.data, word)
 	case cc == '#':
 		ap.iterateCharacter()
 
+		count := Word(0)
+
+		if ap.currentCharacter() == '(' {
+			count, err = ap.parseCount()
+		} else {
+			count, err = ap.parseSigned('+', base)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !isVoid(ap.currentCharacter()) {
+			return ap.buildError("space")
+		}
+
+		if err := ap.checkData(mac, count); err != nil {
+			return err
+		}
+
 		off := len(mac.data)
 
-		mac.data = growSlice(mac.data, off+int(ap.parseNumberABS(base)))
+		mac.data = growSlice(mac.data, off+int(count))
 
 		for i := range mac.data[off:] {
-			mac.data[off+i] = word * sign
+			mac.data[off+i] = word
 		}
 	default:
-		return ap.buildError("character", "space or '#'")
+		return ap.buildError("space", "'#'")
+	}
+
+	return nil
+}
+
+func (ap *AsmParser) parseLabel(mac *Machine) error {
+	name := ap.parseIdentifier()
+
+	if ap.currentCharacter() != ':' {
+		if m, ok := ap.state().macros[name]; ok {
+			return ap.expand(mac, m)
+		}
+
+		return ap.buildError("':' after label name")
+	}
+
+	ap.iterateCharacter()
+
+	name = ap.localName(name)
+	st := ap.state()
+
+	if prev, ok := st.labels[name]; ok {
+		return ap.buildLineError("duplicate label \"" + name + "\", previously defined at " + prev.where)
 	}
 
+	st.labels[name] = label{
+		code:  Word(len(mac.code)),
+		data:  Word(len(mac.data)),
+		where: ap.newError(ap.start, "").Position(),
+	}
+	st.order = append(st.order, name)
+
 	return nil
 }
 
-func (ap *AsmParser) parseNumberABS(base int64) (word int64) {
+// parseReference - parses label reference.
+// Reference "@origin>target" is offset which CJ instruction at origin adds to code pointer to jump to target,
+// and reference "&origin>target" is number of data words from origin to target.
+func (ap *AsmParser) parseReference(mac *Machine) error {
+	e, err := ap.parseOperand()
+	if err != nil {
+		return err
+	}
+
+	if ap.currentCharacter() == '>' {
+		ap.iterateCharacter()
+
+		name := ap.parseIdentifier()
+		if name == "" {
+			return ap.buildError("label name")
+		}
+
+		e = &expr{op: "-", x: &expr{ref: e.ref, name: ap.localName(name)}, y: e}
+
+		if e.x.ref == '@' {
+			e = &expr{op: "-", x: e, y: &expr{val: 1}}
+		}
+	}
+
+	if !isVoid(ap.currentCharacter()) {
+		return ap.buildError("space")
+	}
+
+	return ap.emit(mac, e, 1)
+}
+
+// parseExprItem - parses parenthesized expression with optional repeat count.
+func (ap *AsmParser) parseExprItem(mac *Machine) error {
+	e, err := ap.parseOperand()
+	if err != nil {
+		return err
+	}
+
+	count := Word(1)
+
+	if ap.currentCharacter() == '#' {
+		ap.iterateCharacter()
+
+		if count, err = ap.parseCount(); err != nil {
+			return err
+		}
+	}
+
+	if !isVoid(ap.currentCharacter()) {
+		return ap.buildError("space", "'#'")
+	}
+
+	return ap.emit(mac, e, count)
+}
+
+// parseCount - parses repeat count expression, which must not refer to labels defined after it.
+func (ap *AsmParser) parseCount() (Word, error) {
+	e, err := ap.parseOperand()
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := ap.eval(e, false)
+
+	switch {
+	case err == errUnresolved:
+		return 0, ap.buildLineError("repeat count refers to label defined after it")
+	case err != nil:
+		return 0, ap.buildLineError(err.Error())
+	case count < 0:
+		return 0, ap.buildLineError("negative repeat count")
+	}
+
+	return count, nil
+}
+
+// maxDataWords, maxCodeLen - maximal numbers of assembled data words and instructions,
+// so repeat counts and macros can not exhaust memory.
+const (
+	maxDataWords = 1 << 24
+	maxCodeLen   = 1 << 24
+)
+
+// checkData - returns error if words appended to data do not fit into maxDataWords.
+func (ap *AsmParser) checkData(mac *Machine, words Word) error {
+	if words > maxDataWords-Word(len(mac.data)) {
+		return ap.buildLineError("data exceeds limit of " + strconv.Itoa(maxDataWords) + " words")
+	}
+
+	return nil
+}
+
+// emit - appends count copies of expression value to data.
+// Expression which refers to labels defined later is evaluated by resolve.
+func (ap *AsmParser) emit(mac *Machine, e *expr, count Word) error {
+	val, err := ap.eval(e, false)
+	if err != nil && err != errUnresolved {
+		return ap.buildLineError(err.Error())
+	}
+
+	if err := ap.checkData(mac, count); err != nil {
+		return err
+	}
+
+	off := len(mac.data)
+
+	mac.data = growSlice(mac.data, off+int(count))
+
+	var at *AsmError
+	if err == errUnresolved {
+		at = ap.newError(ap.start, "")
+		at.Token = ap.tokenAt(ap.start)
+	}
+
+	for i := range mac.data[off:] {
+		mac.data[off+i] = val
+
+		if at != nil {
+			ap.st.fixups = append(ap.st.fixups, fixup{index: off + i, expr: e, at: at})
+		}
+	}
+
+	return nil
+}
+
+// parseDirective - parses directive starting with '.'.
+//
+//	.equ NAME operand - defines named constant.
+//	.macro NAME PARAM... - defines macro till .endm line.
+//	.include "path" - parses file from file system set by SetFS.
+func (ap *AsmParser) parseDirective(mac *Machine) error {
+	ap.iterateCharacter()
+
+	switch name := ap.parseIdentifier(); name {
+	case "equ":
+		return ap.parseEqu()
+	case "macro":
+		return ap.parseMacro()
+	case "include":
+		return ap.parseInclude(mac)
+	default:
+		return ap.buildLineError("unknown directive \"." + name + "\"")
+	}
+}
+
+func (ap *AsmParser) parseEqu() error {
+	ap.skipWhitespaces()
+
+	start := ap.pos
+
+	name := ap.parseIdentifier()
+	if name == "" {
+		return ap.buildError("constant name")
+	}
+
+	e, err := ap.parseOperand()
+	if err != nil {
+		return err
+	}
+
+	if !isVoid(ap.currentCharacter()) {
+		return ap.buildError("space")
+	}
+
+	if _, ok := ap.state().consts[name]; ok {
+		return ap.buildErrorAt(start, "duplicate constant \""+name+"\"")
+	}
+
+	ap.st.consts[name] = e
+
+	return nil
+}
+
+// state - returns shared state of parser, which is initialized with predefined constants.
+func (ap *AsmParser) state() *asmState {
+	if ap.st == nil {
+		ap.st = &asmState{
+			labels: make(map[string]label),
+			consts: map[string]*expr{
+				"BlockSize": {val: BlockSize},
+			},
+			macros: make(map[string]*macro),
+		}
+	}
+
+	return ap.st
+}
+
+// resolve - second pass, which evaluates expressions referring to labels defined after them.
+// Repeated word is reported once.
+func (ap *AsmParser) resolve(mac *Machine) {
+	st := ap.state()
+
+	for i, fx := range st.fixups {
+		val, err := ap.eval(fx.expr, true)
+		if err != nil {
+			if i == 0 || st.fixups[i-1].at != fx.at {
+				e := *fx.at
+				e.Msg = err.Error()
+				st.errs.add(&e)
+			}
+
+			continue
+		}
+
+		mac.data[fx.index] = val
+	}
+
+	st.fixups = st.fixups[:0]
+}
+
+func (ap *AsmParser) parseIdentifier() string {
+	start := ap.pos
+
+	for cc := ap.currentCharacter(); isIdentifierStart(cc) || cc >= '0' && cc <= '9' || cc == '.'; cc = ap.currentCharacter() {
+		ap.iterateCharacter()
+	}
+
+	return ap.src[start:ap.pos]
+}
+
+// parseSigned - parses digits of number with sign character:
+// '+' and '-' accept magnitude of signed word, '~' accepts any unsigned word as its two's complement.
+func (ap *AsmParser) parseSigned(sign byte, base int64) (Word, error) {
+	limit := uint64(math.MaxInt64)
+
+	switch sign {
+	case '-':
+		limit++
+	case '~':
+		limit = math.MaxUint64
+	}
+
+	mag, err := ap.parseDigits(base, limit)
+	if sign == '-' {
+		mag = -mag
+	}
+
+	return Word(mag), err
+}
+
+// parseDigits - parses number in given base, which must have at least one digit,
+// may have '_' between digits and must not be greater than limit.
+// Digits greater than 9 are letters in any case.
+func (ap *AsmParser) parseDigits(base int64, limit uint64) (uint64, error) {
+	start := ap.pos
+
+	mag := uint64(0)
+	overflow := false
+
 	for {
 		cc := ap.currentCharacter()
 
-		dec := byteOf(cc >= '0' && cc <= '9' && cc < '0'+byte(base))
-		hex := byteOf(cc >= 'A' && cc <= 'Z' && cc < '7'+byte(base))
-		if dec+hex == 0 {
+		if cc == '_' && ap.pos != start && digitOf(ap.peekCharacter(1)) < base {
+			ap.iterateCharacter()
+			continue
+		}
+
+		d := digitOf(cc)
+		if d >= base {
 			break
 		}
 
-		word = word*base + int64(cc-'0'*dec-'7'*hex)
+		if mag > (limit-uint64(d))/uint64(base) {
+			overflow = true
+		}
+
+		mag = mag*uint64(base) + uint64(d)
 
 		ap.iterateCharacter()
 	}
 
-	return
+	switch {
+	case ap.pos == start:
+		return 0, ap.buildError("digit")
+	case overflow:
+		return 0, ap.buildErrorAt(start, "number out of range")
+	}
+
+	return mag, nil
 }
 
 func (ap *AsmParser) testFlag(name byte, code Code) Code {
@@ -209,6 +633,14 @@ func (ap *AsmParser) iterateCharacter() {
 	ap.pos++
 }
 
+func (ap *AsmParser) peekCharacter(n int) byte {
+	if ap.pos+n < len(ap.src) {
+		return ap.src[ap.pos+n]
+	}
+
+	return 0
+}
+
 func (ap *AsmParser) currentCharacter() byte {
 	if ap.pos < len(ap.src) {
 		return ap.src[ap.pos]
@@ -216,11 +648,3 @@ func (ap *AsmParser) currentCharacter() byte {
 
 	return 0
 }
-
-func (ap *AsmParser) buildError(unexpect, expect string) error {
-	return errors.New(strings.Join([]string{
-		"line ", strconv.Itoa(ap.line),
-		": unexpected ", unexpect,
-		": ", expect, " expected",
-	}, ""))
-}
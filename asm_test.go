@@ -15,7 +15,11 @@
 package mabvm
 
 import (
+	"math"
+	"strconv"
+	"strings"
 	"testing"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -156,6 +160,41 @@ func TestAsmParser_parseNumber(t *testing.T) {
 			source: "-h0000A000#1",
 			expect: []Word{-0xA000},
 		},
+		{
+			name:   "lowercase hexadecimal number",
+			source: "+hdeadBEEF",
+			expect: []Word{0xDEADBEEF},
+		},
+		{
+			name:   "separators",
+			source: "+d1_000_000#1_0",
+			expect: []Word{1e6, 1e6, 1e6, 1e6, 1e6, 1e6, 1e6, 1e6, 1e6, 1e6},
+		},
+		{
+			name:   "maximal positive number",
+			source: "+d9223372036854775807",
+			expect: []Word{math.MaxInt64},
+		},
+		{
+			name:   "minimal negative number",
+			source: "-h8000000000000000",
+			expect: []Word{math.MinInt64},
+		},
+		{
+			name:   "two's complement number",
+			source: "~hFFFF_FFFF_FFFF_FFFF",
+			expect: []Word{-1},
+		},
+		{
+			name:   "two's complement minimal number",
+			source: "~h8000000000000000",
+			expect: []Word{math.MinInt64},
+		},
+		{
+			name:   "two's complement positive number",
+			source: "~d42",
+			expect: []Word{42},
+		},
 	}
 
 	for _, test := range tests {
@@ -170,6 +209,77 @@ func TestAsmParser_parseNumber(t *testing.T) {
 	}
 }
 
+func TestAsmParser_parseNumberError(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect string
+	}{
+		{
+			name:   "positive overflow",
+			source: "+d9223372036854775808",
+			expect: "1:3: number out of range",
+		},
+		{
+			name:   "negative overflow",
+			source: "-h8000000000000001",
+			expect: "1:3: number out of range",
+		},
+		{
+			name:   "two's complement overflow",
+			source: "~h1_0000_0000_0000_0000",
+			expect: "1:3: number out of range",
+		},
+		{
+			name:   "count overflow",
+			source: "+d1#99999999999999999999",
+			expect: "1:5: number out of range",
+		},
+		{
+			name:   "empty digits",
+			source: "+h",
+			expect: "1:3: unexpected EOF: digit expected",
+		},
+		{
+			name:   "empty count",
+			source: "+d1#",
+			expect: "1:5: unexpected EOF: digit expected",
+		},
+		{
+			name:   "leading separator",
+			source: "+d_1",
+			expect: `1:3: unexpected "_1": digit expected`,
+		},
+		{
+			name:   "trailing separator",
+			source: "+d1_",
+			expect: `1:4: unexpected "_": space or '#' expected`,
+		},
+		{
+			name:   "double separator",
+			source: "+d1__2",
+			expect: `1:4: unexpected "__2": space or '#' expected`,
+		},
+		{
+			name:   "digit out of base",
+			source: "+o78",
+			expect: `1:4: unexpected "8": space or '#' expected`,
+		},
+		{
+			name:   "operand overflow",
+			source: "(+d1 + 99999999999999999999)",
+			expect: "1:8: number out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ap := NewAsmParser(tt.source)
+			assert.EqualError(t, ap.Parse(&Machine{}), tt.expect)
+		})
+	}
+}
+
 func TestAsmParserParse(t *testing.T) {
 	test := struct {
 		source string
@@ -195,6 +305,283 @@ func TestAsmParserParse(t *testing.T) {
 	assert.Equal(t, test.expect, mc)
 }
 
+func TestAsmParserLabels(t *testing.T) {
+	ap := NewAsmParser(`
+	@back>loop @loop @back>done @done
+loop:
+	:V
+	:D'I
+back:
+	:C'E
+done:`)
+
+	mc := &Machine{}
+
+	assert.Equal(t, nil, ap.Parse(mc))
+	assert.Equal(t, []Code{VJ, DJ | IF, CJ | EF}, mc.code)
+	assert.Equal(t, []Word{-3, 0, 0, 3}, mc.data)
+}
+
+func TestAsmParserDataLabels(t *testing.T) {
+	textB := [8]byte{'H', 'i', ',', ' ', 'M', 'A', 'B', '\n'}
+	textW := *(*Word)(unsafe.Pointer(&textB))
+
+	ap := NewAsmParser(`
+	+d0
+one:
+	+d0
+two:
+	+d0#4093
+flag:
+	+d0#4092
+text:
+	+h0A42414D202C6948
+	+d0 &two>flag
+	+d0 &one>text
+	&text &flag`)
+
+	mc := &Machine{}
+
+	assert.Equal(t, nil, ap.Parse(mc))
+	assert.Equal(t, append(make([]Word, 8187), textW, 0, 4093, 0, 8186, 8187, 4095), mc.data)
+}
+
+func TestAsmParserExpressions(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect []Word
+	}{
+		{
+			name:   "precedence",
+			source: "(1+2*3-8/2) (1<<4|3&1) ((1+2)*3) (-+hA+-3) (-(2-5))",
+			expect: []Word{3, 17, 9, -13, 3},
+		},
+		{
+			name:   "block size",
+			source: "(BlockSize*2-3)",
+			expect: []Word{BlockSize*2 - 3},
+		},
+		{
+			name: "constants",
+			source: `.equ N +d3
+			.equ M (N * N)
+			(M - N)#N +b1#(N-1)`,
+			expect: []Word{6, 6, 6, 1, 1},
+		},
+		{
+			name: "labels",
+			source: `(&end - &buf - 1) (@end)
+			buf: +d0#(4) :V :V
+			end: (&buf)`,
+			expect: []Word{3, 2, 0, 0, 0, 0, 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mc := &Machine{}
+
+			ap := NewAsmParser(test.source)
+
+			assert.Equal(t, nil, ap.Parse(mc))
+			assert.Equal(t, test.expect, mc.data)
+		})
+	}
+}
+
+func TestAsmParserExpressionsError(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect string
+	}{
+		{
+			name:   "undefined constant",
+			source: "(N+1)",
+			expect: `1:2: undefined constant "N"`,
+		},
+		{
+			name:   "forward count",
+			source: "+d1#(&a) a:",
+			expect: "1:1: repeat count refers to label defined after it",
+		},
+		{
+			name:   "huge count",
+			source: "(1<<62)#(1<<40)",
+			expect: "1:1: data exceeds limit of 16777216 words",
+		},
+		{
+			name:   "huge number count",
+			source: "+d1 +hab#FFFFFFF",
+			expect: "1:5: data exceeds limit of 16777216 words",
+		},
+		{
+			name:   "string beyond data limit",
+			source: "(0)#((1<<24)-1) \"abc\"n",
+			expect: "1:17: data exceeds limit of 16777216 words",
+		},
+		{
+			name:   "division by zero",
+			source: "\n(1/0)",
+			expect: "2:1: division by zero",
+		},
+		{
+			name:   "late division by zero",
+			source: "(1/(@a-@a)) a:",
+			expect: "1:1: division by zero",
+		},
+		{
+			name:   "unclosed",
+			source: "(1+2",
+			expect: "1:5: unexpected EOF: operator or ')' expected",
+		},
+		{
+			name:   "duplicate constant",
+			source: ".equ BlockSize 1",
+			expect: `1:6: duplicate constant "BlockSize"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ap := NewAsmParser(test.source)
+
+			assert.EqualError(t, ap.Parse(&Machine{}), test.expect)
+		})
+	}
+}
+
+func TestAsmParserMacros(t *testing.T) {
+	ap := NewAsmParser(`
+.macro add k ; adds k to source
+	\k
+	:V'E
+.endm
+.macro loop n
+again:
+	(\n) @back>again
+	:V
+back:
+	:C'E
+.endm
+	add +d5
+	loop (1 + 2)
+	loop 4
+	add (@again)
+again:`)
+
+	mc := &Machine{}
+
+	assert.Equal(t, nil, ap.Parse(mc))
+	assert.Equal(t, []Code{VJ | EF, VJ, CJ | EF, VJ, CJ | EF, VJ | EF}, mc.code)
+	assert.Equal(t, []Word{5, 3, -2, 4, -2, 6}, mc.data)
+}
+
+func TestAsmParserMacrosError(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect string
+	}{
+		{
+			name:   "body error",
+			source: ".macro m a\n\t\\a\n\t!\n.endm\n\n\tm +d1",
+			expect: "6:2: in macro \"m\": 3:2: unexpected \"!\": '+', '-' or '~' expected",
+		},
+		{
+			name:   "nested body error",
+			source: ".macro m\n\tx\n.endm\n.macro n\n\tm\n.endm\nn",
+			expect: "7:1: in macro \"n\": 5:2: in macro \"m\": 2:3: unexpected end of line: ':' after label name expected",
+		},
+		{
+			name:   "local label undefined",
+			source: ".macro m\n\t@x\n.endm\nm",
+			expect: "4:1: in macro \"m\": 2:2: undefined label \"x\"",
+		},
+		{
+			name:   "arguments",
+			source: ".macro m a b\n.endm\nm +d1",
+			expect: "3:1: macro \"m\" expects 2 arguments, got 1",
+		},
+		{
+			name:   "unknown parameter",
+			source: ".macro m a\n\\b\n.endm\nm +d1",
+			expect: "4:1: macro \"m\" has no parameter \"b\"",
+		},
+		{
+			name:   "recursion",
+			source: ".macro m\nm\n.endm\nm",
+			expect: "4:1: in macro \"m\": " + strings.Repeat("2:1: in macro \"m\": ", 63) + "2:1: macro expansion is too deep",
+		},
+		{
+			name:   "doubling calls",
+			source: doublingMacros(40, "+d1") + "m40",
+			expect: "164:1: macro expansions exceed limit of 65536 calls",
+		},
+		{
+			name:   "doubling items",
+			source: doublingMacros(15, strings.Repeat("+d1 ", 64)) + "m15",
+			expect: "64:1: macro expansions exceed limit of 1048576 items",
+		},
+		{
+			name:   "not closed",
+			source: "\n.macro m\n:V",
+			expect: "2:1: macro \"m\" is not closed with .endm",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ap := NewAsmParser(test.source)
+
+			assert.EqualError(t, ap.Parse(&Machine{}), test.expect)
+		})
+	}
+}
+
+func TestAsmParserLabelsError(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect string
+	}{
+		{
+			name:   "undefined target",
+			source: "a:\n:V\n@a>b",
+			expect: `3:1: undefined label "b"`,
+		},
+		{
+			name:   "undefined origin",
+			source: "a:\n\n@c>a",
+			expect: `3:1: undefined label "c"`,
+		},
+		{
+			name:   "duplicate",
+			source: "a:\n:V\na:",
+			expect: `3:1: duplicate label "a", previously defined at 1:1`,
+		},
+		{
+			name:   "undefined data label",
+			source: "\n&a",
+			expect: `2:1: undefined label "a"`,
+		},
+		{
+			name:   "missing colon",
+			source: "a :V",
+			expect: "1:2: unexpected space: ':' after label name expected",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ap := NewAsmParser(test.source)
+
+			assert.EqualError(t, ap.Parse(&Machine{}), test.expect)
+		})
+	}
+}
+
 func BenchmarkAsmParserParse(b *testing.B) {
 	src := `+d484932984 :D'I :V :S :D'I :V'I :S :D`
 
@@ -207,3 +594,16 @@ func BenchmarkAsmParserParse(b *testing.B) {
 		ap.Parse(mc)
 	}
 }
+
+// doublingMacros - returns definitions of macros m0 with body leaf and mN calling m(N-1) twice.
+func doublingMacros(levels int, leaf string) string {
+	sb := strings.Builder{}
+	sb.WriteString(".macro m0\n" + leaf + "\n.endm\n")
+
+	for i := 1; i <= levels; i++ {
+		prev := "m" + strconv.Itoa(i-1)
+		sb.WriteString(".macro m" + strconv.Itoa(i) + "\n" + prev + "\n" + prev + "\n.endm\n")
+	}
+
+	return sb.String()
+}
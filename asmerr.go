@@ -0,0 +1,209 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// maxErrors - number of errors after which parser stops.
+const maxErrors = 100
+
+// AsmError - assembler error located in source.
+// Line and Column are 1-based, Column counts bytes.
+type AsmError struct {
+	File   string
+	Line   int
+	Column int
+
+	// Token - offending token, it is empty at space, end of line and EOF.
+	Token string
+	// Expect - expected alternatives, it is empty for errors which are not syntax errors.
+	Expect []string
+	Msg    string
+
+	// Site - locations of macro calls, which expanded erroneous line.
+	Site string
+	// Snippet - source line with caret under Column.
+	Snippet string
+}
+
+// Position - returns "file:line:column", or "line:column" for source without file name.
+func (e *AsmError) Position() string {
+	return position(e.File, e.Line, e.Column)
+}
+
+func (e *AsmError) Error() string {
+	return e.Site + e.Position() + ": " + e.Msg
+}
+
+func position(file string, line, column int) string {
+	pos := strconv.Itoa(line) + ":" + strconv.Itoa(column)
+	if file == "" {
+		return pos
+	}
+
+	return file + ":" + pos
+}
+
+// ErrorList - errors of single parse in order of their detection.
+type ErrorList []*AsmError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	return l[0].Error() + " (and " + strconv.Itoa(len(l)-1) + " more errors)"
+}
+
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, e := range l {
+		errs[i] = e
+	}
+
+	return errs
+}
+
+// Err - returns nil for empty list and list itself otherwise.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+func (l *ErrorList) add(err error) {
+	var e *AsmError
+	if !errors.As(err, &e) {
+		e = &AsmError{Msg: err.Error()}
+	}
+
+	*l = append(*l, e)
+}
+
+// newError - returns error located at pos, which is on current line or before it.
+func (ap *AsmParser) newError(pos int, msg string) *AsmError {
+	pos = min(pos, len(ap.src))
+
+	start := strings.LastIndexByte(ap.src[:pos], '\n') + 1
+	end := len(ap.src)
+
+	if i := strings.IndexByte(ap.src[pos:], '\n'); i >= 0 {
+		end = pos + i
+	}
+
+	return &AsmError{
+		File:    ap.file,
+		Line:    ap.lineAt(pos) + 1,
+		Column:  pos - start + 1,
+		Msg:     msg,
+		Site:    ap.site,
+		Snippet: snippet(ap.src[start:end], pos-start),
+	}
+}
+
+// lineAt - returns 0-based line of pos, which is on current line or before it.
+func (ap *AsmParser) lineAt(pos int) int {
+	if pos >= ap.pos {
+		return ap.line
+	}
+
+	return ap.line - strings.Count(ap.src[pos:min(ap.pos, len(ap.src))], "\n")
+}
+
+// snippet - returns text with caret under column, preserving tabs before it.
+func snippet(text string, column int) string {
+	caret := []byte(text[:column])
+
+	for i, c := range caret {
+		if c != '\t' {
+			caret[i] = ' '
+		}
+	}
+
+	return text + "\n" + string(caret) + "^"
+}
+
+// tokenAt - returns token at pos, which ends with space.
+func (ap *AsmParser) tokenAt(pos int) string {
+	end := pos
+
+	for end < len(ap.src) && !isVoid(ap.src[end]) {
+		end++
+	}
+
+	return ap.src[min(pos, end):end]
+}
+
+// buildLineError - builds error at start of current item.
+func (ap *AsmParser) buildLineError(msg string) error {
+	return ap.buildErrorAt(ap.start, msg)
+}
+
+// buildErrorAt - builds error at token starting at pos.
+func (ap *AsmParser) buildErrorAt(pos int, msg string) error {
+	e := ap.newError(pos, msg)
+	e.Token = ap.tokenAt(pos)
+
+	return e
+}
+
+// buildError - builds syntax error at current character.
+func (ap *AsmParser) buildError(expect ...string) error {
+	e := ap.newError(ap.pos, "")
+	e.Expect = expect
+
+	unexpect := ""
+
+	switch cc := ap.currentCharacter(); {
+	case cc == '\x00':
+		unexpect = "EOF"
+	case cc == '\n':
+		unexpect = "end of line"
+	case isVoid(cc):
+		unexpect = "space"
+	default:
+		e.Token = ap.tokenAt(ap.pos)
+		unexpect = strconv.Quote(e.Token)
+	}
+
+	e.Msg = "unexpected " + unexpect + ": " + alternatives(expect) + " expected"
+
+	return e
+}
+
+// alternatives - joins alternatives as "a, b or c".
+func alternatives(expect []string) string {
+	if len(expect) < 2 {
+		return strings.Join(expect, "")
+	}
+
+	return strings.Join(expect[:len(expect)-1], ", ") + " or " + expect[len(expect)-1]
+}
+
+// skipToken - skips characters till next whitespace to recover after error.
+func (ap *AsmParser) skipToken() {
+	for cc := ap.currentCharacter(); !isVoid(cc); cc = ap.currentCharacter() {
+		ap.iterateCharacter()
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsmError(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect *AsmError
+	}{
+		{
+			name:   "sign",
+			source: "+d1\n\t+d2 !x +d3",
+			expect: &AsmError{
+				Line:    2,
+				Column:  6,
+				Token:   "!x",
+				Expect:  []string{"'+'", "'-'", "'~'"},
+				Msg:     `unexpected "!x": '+', '-' or '~' expected`,
+				Snippet: "\t+d2 !x +d3\n\t    ^",
+			},
+		},
+		{
+			name:   "EOF",
+			source: "(1 +",
+			expect: &AsmError{
+				Line:    1,
+				Column:  5,
+				Expect:  []string{"operand"},
+				Msg:     "unexpected EOF: operand expected",
+				Snippet: "(1 +\n    ^",
+			},
+		},
+		{
+			name:   "undefined label",
+			source: "+d1\n  @x",
+			expect: &AsmError{
+				Line:    2,
+				Column:  3,
+				Token:   "@x",
+				Msg:     `undefined label "x"`,
+				Snippet: "  @x\n  ^",
+			},
+		},
+		{
+			name:   "macro",
+			source: ".macro m\n\t:X\n.endm\nm",
+			expect: &AsmError{
+				Line:    2,
+				Column:  3,
+				Token:   "X",
+				Expect:  []string{"'S'", "'D'", "'C'", "'V'"},
+				Msg:     `unexpected "X": 'S', 'D', 'C' or 'V' expected`,
+				Site:    `4:1: in macro "m": `,
+				Snippet: "\t:X\n\t ^",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ap := NewAsmParser(tt.source)
+
+			var errs ErrorList
+			assert.True(t, errors.As(ap.Parse(&Machine{}), &errs))
+			assert.Equal(t, ErrorList{tt.expect}, errs)
+		})
+	}
+}
+
+func TestAsmErrorList(t *testing.T) {
+	ap := NewAsmParser("+d1 !\n:X +d2\n@x\n.equ N +q1\n+d3")
+	mc := &Machine{}
+
+	err := ap.Parse(mc)
+	assert.EqualError(t, err, `1:5: unexpected "!": '+', '-' or '~' expected (and 3 more errors)`)
+
+	var errs ErrorList
+	assert.True(t, errors.As(err, &errs))
+
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+
+	assert.Equal(t, []string{
+		`1:5: unexpected "!": '+', '-' or '~' expected`,
+		`2:2: unexpected "X": 'S', 'D', 'C' or 'V' expected`,
+		`4:8: unexpected "+q1": operand expected`,
+		`3:1: undefined label "x"`,
+	}, msgs)
+	assert.Equal(t, []Word{1, 2, 0, 3}, mc.data)
+
+	var e *AsmError
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, errs[0], e)
+
+	assert.Equal(t, nil, ErrorList{}.Err())
+	assert.Equal(t, "no errors", ErrorList{}.Error())
+}
+
+func TestAsmErrorFile(t *testing.T) {
+	ap, err := NewAsmParserFS(fstest.MapFS{
+		"main.asm": {Data: []byte(".include \"lib.asm\"\n\t:S'Q\n")},
+		"lib.asm":  {Data: []byte("\n+d1 +x1\n")},
+	}, "main.asm")
+	assert.Equal(t, nil, err)
+
+	err = ap.Parse(&Machine{})
+
+	var errs ErrorList
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 2)
+
+	assert.Equal(t, "lib.asm:2:6: unexpected \"x1\": 'b', 'o', 'd' or 'h' expected", errs[0].Error())
+	assert.Equal(t, "+d1 +x1\n     ^", errs[0].Snippet)
+	assert.Equal(t, "main.asm:2:5: unexpected \"Q\": flag sequence ('I' - 'E' - 'M' - 'L' - 'E' - 'G') expected", errs[1].Error())
+}
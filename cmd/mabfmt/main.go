@@ -0,0 +1,116 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command mabfmt formats MAB assembly in canonical form.
+//
+// Usage:
+//
+//	mabfmt [-l] [-w] [file ...]
+//
+// Without files it formats standard input to standard output.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mandriota/mabvm"
+)
+
+var (
+	list  = flag.Bool("l", false, "list files whose formatting differs from mabfmt's")
+	write = flag.Bool("w", false, "write result to source file instead of stdout")
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		if err := format("<stdin>", os.Stdin, os.Stdout, false); err != nil {
+			report(err)
+			os.Exit(2)
+		}
+
+		return
+	}
+
+	code := 0
+
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err == nil {
+			err = format(name, f, os.Stdout, true)
+			f.Close()
+		}
+
+		if err != nil {
+			report(err)
+			code = 2
+		}
+	}
+
+	os.Exit(code)
+}
+
+func format(name string, r io.Reader, w io.Writer, file bool) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	res, err := mabvm.FormatAsm(src)
+	if err != nil {
+		if errs, ok := err.(mabvm.ErrorList); ok {
+			for _, e := range errs {
+				e.File = name
+			}
+		}
+
+		return err
+	}
+
+	if *list && !bytes.Equal(src, res) {
+		fmt.Fprintln(w, name)
+	}
+
+	if *write && file {
+		if !bytes.Equal(src, res) {
+			return os.WriteFile(name, res, 0o644)
+		}
+
+		return nil
+	}
+
+	if !*list {
+		_, err = w.Write(res)
+	}
+
+	return err
+}
+
+// report - prints every error of list on its own line.
+func report(err error) {
+	errs, ok := err.(mabvm.ErrorList)
+	if !ok {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	for _, e := range errs {
+		fmt.Fprintln(os.Stderr, e)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"sync/atomic"
+)
+
+// inst - pre-decoded instruction.
+type inst struct {
+	op   Code
+	jump Code
+
+	// sign - multiplier of k, -1 for IF.
+	sign Word
+
+	ext   bool
+	mutex bool
+
+	// cond - true if any conditional flag is set.
+	// Instruction without conditional flags is never skipped.
+	cond bool
+
+	// l, e, g - multipliers of source in conditional flags test.
+	l, e, g Word
+}
+
+func decode(op Code) inst {
+	return inst{
+		op:    op,
+		jump:  op & JMask,
+		sign:  1 - Word(op)&IF>>1,
+		ext:   op&EF == EF,
+		mutex: op&MF == MF,
+		cond:  op&(LC|EC|GC) != 0,
+		l:     Word(op) & LC >> 5,
+		e:     Word(op) & EC >> 6,
+		g:     Word(op) & GC >> 7,
+	}
+}
+
+func compile(code []Code) []inst {
+	prog := make([]inst, len(code))
+
+	for i, op := range code {
+		prog[i] = decode(op)
+	}
+
+	return prog
+}
+
+// program - returns compiled code. Code is recompiled when its length changes.
+func (mac *Machine) program() []inst {
+	if len(mac.prog) != len(mac.code) {
+		mac.prog = compile(mac.code)
+	}
+
+	return mac.prog
+}
+
+// shared - reports whether any block of mutex table is shared or owned by someone else,
+// so data must be accessed atomically.
+func (mac *Machine) shared() bool {
+	if mac.mtab == nil {
+		return false
+	}
+
+	for _, b := range mac.mtab.Blocks() {
+		if b.Shared || b.Owner != nil && b.Owner != &mac.RWMutex {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restricted - reports whether any block of mutex table can not be read or written by machine,
+// so every instruction must be checked by protect.
+func (mac *Machine) restricted() bool {
+	if mac.mtab == nil {
+		return false
+	}
+
+	for _, b := range mac.mtab.Blocks() {
+		if !b.allows(&mac.RWMutex, PermRW) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (mac *Machine) load(i Word, shared bool) Word {
+	switch {
+	case mac.pt != nil:
+		return mac.pt.load(i, mac.geom)
+	case shared:
+		return atomic.LoadInt64(&mac.data[i])
+	}
+
+	return mac.data[i]
+}
+
+// put - writes v to word i without side effects of store.
+func (mac *Machine) put(i, v Word, shared bool) {
+	switch {
+	case mac.pt != nil:
+		mac.pt.store(i, v, mac.geom)
+	case shared:
+		atomic.StoreInt64(&mac.data[i], v)
+	default:
+		mac.data[i] = v
+	}
+}
+
+func (mac *Machine) store(i, v Word, shared bool) {
+	mac.put(i, v, shared)
+
+	if i == mac.haltP {
+		mac.halted = true
+		mac.halt(StopHalt, v)
+	}
+
+	if i == mac.growP {
+		mac.growRequest(i, v, shared)
+	}
+
+	if mac.bus != nil {
+		mac.bus.store(i, v)
+	}
+}
+
+// exec - executes decoded instruction with semantics of Tick.
+func (mac *Machine) exec(in *inst, shared bool) {
+	if in.mutex {
+		prev := mac.setState(StateBlocked)
+		synchronize(&mac.RWMutex)
+		mac.setState(prev)
+	}
+
+	cc := Word(1)
+
+	if in.ext {
+		cc = mac.load(mac.srcP, shared)
+		mac.srcP--
+	}
+
+	if in.cond {
+		srcD := mac.load(mac.srcP, shared)
+		dstD := mac.load(mac.dstP, shared)
+
+		if in.g*srcD >= dstD && in.e*srcD != dstD && in.l*srcD <= dstD {
+			return
+		}
+	}
+
+	cc *= in.sign
+
+	switch in.jump {
+	case SJ:
+		mac.srcP += cc
+	case DJ:
+		mac.dstP += cc
+	case CJ:
+		mac.codP += cc
+	case VJ:
+		mac.store(mac.dstP, mac.load(mac.srcP, shared)+cc, shared)
+
+		mac.srcP--
+		mac.dstP++
+
+		dstM := mac.mtab.Blocks()[mac.geom.Block(mac.dstP)].Owner
+		if dstM != nil && dstM != &mac.RWMutex {
+			dstM.TryLock()
+		}
+	}
+
+	mac.codP++
+}
+
+// execPlain - executes code like Show for machine, which owns all its blocks, keeping pointers in local variables.
+// Instructions with MF and stores to halt or grow word are executed by exec.
+func (mac *Machine) execPlain(prog []inst) {
+	codP, srcP, dstP := mac.codP, mac.srcP, mac.dstP
+	data := mac.data
+
+	for codP < Word(len(prog)) {
+		in := &prog[codP]
+
+		if in.mutex || in.jump == VJ && (dstP == mac.haltP || dstP == mac.growP) {
+			mac.codP, mac.srcP, mac.dstP = codP, srcP, dstP
+			mac.exec(in, false)
+
+			if mac.halted {
+				return
+			}
+
+			codP, srcP, dstP = mac.codP, mac.srcP, mac.dstP
+			data = mac.data
+
+			continue
+		}
+
+		cc := Word(1)
+
+		if in.ext {
+			cc = data[srcP]
+			srcP--
+		}
+
+		if in.cond {
+			srcD, dstD := data[srcP], data[dstP]
+
+			if in.g*srcD >= dstD && in.e*srcD != dstD && in.l*srcD <= dstD {
+				continue
+			}
+		}
+
+		cc *= in.sign
+
+		switch in.jump {
+		case SJ:
+			srcP += cc
+		case DJ:
+			dstP += cc
+		case CJ:
+			codP += cc
+		case VJ:
+			data[dstP] = data[srcP] + cc
+			srcP--
+			dstP++
+		}
+
+		codP++
+	}
+
+	mac.codP, mac.srcP, mac.dstP = codP, srcP, dstP
+}
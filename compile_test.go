@@ -0,0 +1,128 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// referenceTick - original opcode-decoding implementation of Tick without MF support.
+func referenceTick(mac *Machine) {
+	op := mac.code[mac.codP]
+
+	cc := Word(1)
+
+	if op&EF == EF {
+		cc = mac.data[mac.srcP]
+		mac.srcP--
+	}
+
+	srcD := mac.data[mac.srcP]
+	dstD := mac.data[mac.dstP]
+
+	if int64(op)&GC>>7*srcD >= dstD &&
+		int64(op)&EC>>6*srcD != dstD &&
+		int64(op)&LC>>5*srcD <= dstD {
+		return
+	}
+
+	cc -= int64(op) & IF >> 1 * cc
+
+	switch op & JMask {
+	case SJ:
+		mac.srcP += cc
+	case DJ:
+		mac.dstP += cc
+	case CJ:
+		mac.codP += cc
+	case VJ:
+		mac.data[mac.dstP] = srcD + cc
+		mac.srcP--
+		mac.dstP++
+	}
+
+	mac.codP++
+}
+
+func randomMachine(r *rand.Rand, codeLen, dataLen int) *Machine {
+	code := make([]Code, codeLen)
+	for i := range code {
+		code[i] = Code(r.Intn(256)) &^ MF
+	}
+
+	data := make([]Word, dataLen)
+	for i := range data {
+		data[i] = Word(r.Intn(7) - 3)
+	}
+
+	return NewMachine(code, data, new(MutexTab))
+}
+
+func cloneMachine(mac *Machine) *Machine {
+	res := NewMachine(mac.code, append([]Word(nil), mac.data...), new(MutexTab))
+	res.codP, res.srcP, res.dstP = mac.codP, mac.srcP, mac.dstP
+
+	return res
+}
+
+func TestMachineExecDifferential(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for n := 0; n < 500; n++ {
+		mac := randomMachine(r, 1+r.Intn(16), 1+r.Intn(32))
+		mac.srcP, mac.dstP = r.Int63n(int64(len(mac.data))), r.Int63n(int64(len(mac.data)))
+
+		ref := cloneMachine(mac)
+
+		for i := 0; i < 200 && mac.check() == nil && mac.codP != Word(len(mac.code)); i++ {
+			mac.Step()
+			referenceTick(ref)
+
+			assert.Equal(t, ref.data, mac.data)
+			assert.Equal(t, [3]Word{ref.codP, ref.srcP, ref.dstP}, [3]Word{mac.codP, mac.srcP, mac.dstP})
+		}
+	}
+}
+
+func TestMachineShowCompiled(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+
+	for n := 0; n < 500; n++ {
+		mac := randomMachine(r, 1+r.Intn(16), 256)
+
+		// code jumps and conditional flags may loop forever
+		for i := range mac.code {
+			mac.code[i] &^= LC | EC | GC
+
+			if mac.code[i]&JMask == CJ {
+				mac.code[i] = mac.code[i]&^JMask | VJ
+			}
+		}
+
+		mac.srcP, mac.dstP = 128, 128
+		ref := cloneMachine(mac)
+
+		mac.Show()
+		for ref.codP != Word(len(ref.code)) {
+			referenceTick(ref)
+		}
+
+		assert.Equal(t, ref.data, mac.data)
+		assert.Equal(t, [3]Word{ref.codP, ref.srcP, ref.dstP}, [3]Word{mac.codP, mac.srcP, mac.dstP})
+	}
+}
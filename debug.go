@@ -0,0 +1,314 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Access - kind of data access caught by watchpoint.
+type Access uint8
+
+const (
+	// AccessRead - instruction loads word.
+	AccessRead Access = 1 << iota
+
+	// AccessWrite - instruction stores word.
+	AccessWrite
+)
+
+// Watchpoint - watched range of data words from Lo to Hi inclusive.
+type Watchpoint struct {
+	Lo, Hi Word
+	Access Access
+}
+
+// Event - describes why debugger stopped.
+// Watch, Addr and Access are set only for StopWatchpoint.
+type Event struct {
+	Reason StopReason
+	CodP   Word
+
+	Watch  int
+	Addr   Word
+	Access Access
+}
+
+type watch struct {
+	Watchpoint
+	id int
+}
+
+// Debugger - drives machine with breakpoints on code pointer and watchpoints on data.
+type Debugger struct {
+	mac *Machine
+
+	breaks  map[Word]struct{}
+	watches []watch
+	watchID int
+
+	ticks uint64
+	hist  history
+}
+
+func NewDebugger(mac *Machine) *Debugger {
+	return &Debugger{
+		mac:    mac,
+		breaks: make(map[Word]struct{}),
+	}
+}
+
+func (d *Debugger) Machine() *Machine {
+	return d.mac
+}
+
+// Ticks - returns number of ticks executed through debugger.
+func (d *Debugger) Ticks() uint64 {
+	return d.ticks
+}
+
+func (d *Debugger) SetBreakpoint(codP Word) {
+	d.breaks[codP] = struct{}{}
+}
+
+func (d *Debugger) ClearBreakpoint(codP Word) {
+	delete(d.breaks, codP)
+}
+
+// SetBreakpointAt - sets breakpoints on instructions emitted by line of file using source map.
+func (d *Debugger) SetBreakpointAt(file string, line int) error {
+	if d.mac.smap == nil {
+		return ErrNoSourceMap
+	}
+
+	codes := d.mac.smap.LineCode(file, line)
+	if len(codes) == 0 {
+		return errors.New("no code at " + SourceLoc{File: file, Line: line}.String())
+	}
+
+	for _, p := range codes {
+		d.SetBreakpoint(p)
+	}
+
+	return nil
+}
+
+// SetBreakpointLabel - sets breakpoint on instruction at label using source map.
+func (d *Debugger) SetBreakpointLabel(name string) error {
+	if d.mac.smap == nil {
+		return ErrNoSourceMap
+	}
+
+	for _, l := range d.mac.smap.Labels {
+		if l.Name == name {
+			d.SetBreakpoint(l.Code)
+			return nil
+		}
+	}
+
+	return errors.New("undefined label \"" + name + "\"")
+}
+
+// Watch - adds watchpoint on data words from lo to hi inclusive and returns its id.
+func (d *Debugger) Watch(lo, hi Word, acc Access) int {
+	d.watchID++
+	d.watches = append(d.watches, watch{Watchpoint{Lo: lo, Hi: hi, Access: acc}, d.watchID})
+
+	return d.watchID
+}
+
+// WatchBlock - adds watchpoint on all words of block and returns its id.
+func (d *Debugger) WatchBlock(block Word, acc Access) int {
+	return d.Watch(d.mac.geom.Start(block), d.mac.geom.Start(block+1)-1, acc)
+}
+
+func (d *Debugger) Unwatch(id int) {
+	for i, w := range d.watches {
+		if w.id == id {
+			d.watches = append(d.watches[:i], d.watches[i+1:]...)
+			return
+		}
+	}
+}
+
+// Where - describes pointers with locations and labels from source map.
+func (d *Debugger) Where() string {
+	mac := d.mac
+
+	return strings.Join([]string{
+		"codP ", strconv.FormatInt(mac.codP, 16), source(mac.smap.CodeSource(mac.codP)),
+		", srcP ", strconv.FormatInt(mac.srcP, 16), source(mac.smap.DataSource(mac.srcP)),
+		", dstP ", strconv.FormatInt(mac.dstP, 16), source(mac.smap.DataSource(mac.dstP)),
+	}, "")
+}
+
+func (d *Debugger) CodP() Word {
+	return d.mac.codP
+}
+
+func (d *Debugger) SrcP() Word {
+	return d.mac.srcP
+}
+
+func (d *Debugger) DstP() Word {
+	return d.mac.dstP
+}
+
+// SetCodP - sets code pointer. Halted or faulted machine becomes ready.
+func (d *Debugger) SetCodP(p Word) {
+	d.mac.codP = p
+	d.resume()
+}
+
+// SetSrcP - sets source pointer. Halted or faulted machine becomes ready.
+func (d *Debugger) SetSrcP(p Word) {
+	d.mac.srcP = p
+	d.resume()
+}
+
+// SetDstP - sets destination pointer. Halted or faulted machine becomes ready.
+func (d *Debugger) SetDstP(p Word) {
+	d.mac.dstP = p
+	d.resume()
+}
+
+func (d *Debugger) resume() {
+	if s := d.mac.State(); s == StateHalted || s == StateFaulted {
+		d.mac.err = nil
+		d.mac.setState(StateReady)
+	}
+}
+
+// Step - executes single instruction.
+func (d *Debugger) Step() (Event, error) {
+	return d.StepN(1)
+}
+
+// StepN - executes up to n instructions, negative n executes nothing like zero.
+// Stops earlier on breakpoint, watchpoint, halt or fault.
+func (d *Debugger) StepN(n int) (Event, error) {
+	return d.run(max(n, 0))
+}
+
+// Continue - executes instructions until breakpoint, watchpoint, halt or fault.
+func (d *Debugger) Continue() (Event, error) {
+	return d.run(-1)
+}
+
+func (d *Debugger) run(n int) (Event, error) {
+	mac := d.mac
+
+	if res, err, ok := mac.finished(); ok {
+		return Event{Reason: res.Reason, CodP: mac.codP}, err
+	}
+
+	if mac.codP == Word(len(mac.code)) {
+		mac.halt(StopEnd, 0)
+		return Event{Reason: StopEnd, CodP: mac.codP}, nil
+	}
+
+	mac.setState(StateRunning)
+	defer func() {
+		if mac.State() == StateRunning {
+			mac.setState(StateReady)
+		}
+	}()
+
+	for i := 0; i != n; i++ {
+		if _, ok := d.breaks[mac.codP]; ok && i != 0 {
+			return Event{Reason: StopBreakpoint, CodP: mac.codP}, nil
+		}
+
+		reads, write := mac.accesses()
+		dt := d.record(write)
+
+		reason, err := mac.advance(true)
+		if reason == StopFault {
+			return Event{Reason: reason, CodP: mac.codP}, err
+		}
+
+		if write >= 0 && mac.codP == dt.codP {
+			write = -1
+			dt.addr = -1
+		}
+
+		d.hist.push(dt)
+		d.ticks++
+
+		if ev, ok := d.watched(reads, write); ok {
+			return ev, nil
+		}
+
+		if reason != StopStep {
+			return Event{Reason: reason, CodP: mac.codP}, nil
+		}
+	}
+
+	return Event{Reason: StopStep, CodP: mac.codP}, nil
+}
+
+func (d *Debugger) watched(reads []Word, write Word) (Event, bool) {
+	for _, w := range d.watches {
+		if w.Access&AccessWrite != 0 && write >= w.Lo && write <= w.Hi {
+			return Event{Reason: StopWatchpoint, CodP: d.mac.codP, Watch: w.id, Addr: write, Access: AccessWrite}, true
+		}
+
+		if w.Access&AccessRead == 0 {
+			continue
+		}
+
+		for _, r := range reads {
+			if r >= w.Lo && r <= w.Hi {
+				return Event{Reason: StopWatchpoint, CodP: d.mac.codP, Watch: w.id, Addr: r, Access: AccessRead}, true
+			}
+		}
+	}
+
+	return Event{}, false
+}
+
+// accesses - returns words which current instruction reads and word which it may write or -1.
+// Like exec, instruction reads source and destination words only to test conditional flags
+// and VJ reads source word to store it.
+func (mac *Machine) accesses() (reads []Word, write Word) {
+	write = -1
+
+	if mac.codP < 0 || mac.codP >= Word(len(mac.code)) {
+		return
+	}
+
+	op := mac.code[mac.codP]
+	srcP := mac.srcP
+
+	if op&EF == EF {
+		reads = append(reads, srcP)
+		srcP--
+	}
+
+	switch {
+	case op&(LC|EC|GC) != 0:
+		reads = append(reads, srcP, mac.dstP)
+	case op&JMask == VJ:
+		reads = append(reads, srcP)
+	}
+
+	if op&JMask == VJ {
+		write = mac.dstP
+	}
+
+	return
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDebugMachine() *Machine {
+	return NewMachine(
+		[]Code{VJ, VJ, VJ, VJ},
+		[]Word{0, 0, 0, 0, 1, 2, 3, 4},
+		new(MutexTab),
+	)
+}
+
+func TestDebugger(t *testing.T) {
+	d := NewDebugger(newDebugMachine())
+	d.SetBreakpoint(2)
+
+	ev, err := d.Continue()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopBreakpoint, CodP: 2}, ev)
+	assert.Equal(t, uint64(2), d.Ticks())
+
+	ev, err = d.Step()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopStep, CodP: 3}, ev)
+
+	id := d.Watch(3, 3, AccessWrite)
+
+	ev, err = d.Continue()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopWatchpoint, CodP: 4, Watch: id, Addr: 3, Access: AccessWrite}, ev)
+
+	ev, err = d.Continue()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopEnd, CodP: 4}, ev)
+	assert.Equal(t, StateHalted, d.Machine().State())
+	assert.Equal(t, []Word{5, 4, 3, 2, 1, 2, 3, 4}, d.Machine().data)
+}
+
+func TestDebuggerWatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  []Code
+		watch func(d *Debugger) int
+		expt  Event
+	}{
+		{
+			name:  "read word",
+			watch: func(d *Debugger) int { return d.Watch(6, 6, AccessRead) },
+			expt:  Event{Reason: StopWatchpoint, CodP: 2, Addr: 6, Access: AccessRead},
+		},
+		{
+			name:  "write block",
+			watch: func(d *Debugger) int { return d.WatchBlock(0, AccessWrite) },
+			expt:  Event{Reason: StopWatchpoint, CodP: 1, Addr: 0, Access: AccessWrite},
+		},
+		{
+			name:  "write ignores read",
+			watch: func(d *Debugger) int { return d.Watch(7, 7, AccessWrite) },
+			expt:  Event{Reason: StopEnd, CodP: 4},
+		},
+		{
+			name:  "read ignores destination of VJ",
+			watch: func(d *Debugger) int { return d.Watch(0, 0, AccessRead) },
+			expt:  Event{Reason: StopEnd, CodP: 4},
+		},
+		{
+			name:  "read ignores pointer jumps",
+			code:  []Code{SJ | IF, DJ, VJ},
+			watch: func(d *Debugger) int { return d.Watch(1, 7, AccessRead) },
+			expt:  Event{Reason: StopWatchpoint, CodP: 3, Addr: 6, Access: AccessRead},
+		},
+		{
+			name:  "read conditional destination",
+			code:  []Code{DJ | GC, VJ},
+			watch: func(d *Debugger) int { return d.Watch(0, 0, AccessRead) },
+			expt:  Event{Reason: StopWatchpoint, CodP: 1, Addr: 0, Access: AccessRead},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mac := newDebugMachine()
+			if test.code != nil {
+				mac.code = test.code
+			}
+
+			d := NewDebugger(mac)
+
+			if id := test.watch(d); test.expt.Reason == StopWatchpoint {
+				test.expt.Watch = id
+			}
+
+			ev, err := d.Continue()
+			assert.Nil(t, err)
+			assert.Equal(t, test.expt, ev)
+		})
+	}
+}
+
+func TestDebuggerStepNegative(t *testing.T) {
+	d := NewDebugger(newDebugMachine())
+
+	ev, err := d.StepN(-5)
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopStep, CodP: 0}, ev)
+	assert.Equal(t, uint64(0), d.Ticks())
+	assert.Equal(t, StateReady, d.Machine().State())
+}
+
+func TestDebuggerPointers(t *testing.T) {
+	d := NewDebugger(newDebugMachine())
+
+	ev, err := d.StepN(10)
+	assert.Nil(t, err)
+	assert.Equal(t, StopEnd, ev.Reason)
+
+	d.SetCodP(3)
+	d.SetSrcP(7)
+	d.SetDstP(0)
+	assert.Equal(t, StateReady, d.Machine().State())
+	assert.Equal(t, [3]Word{3, 7, 0}, [3]Word{d.CodP(), d.SrcP(), d.DstP()})
+
+	ev, err = d.Step()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopEnd, CodP: 4}, ev)
+	assert.Equal(t, Word(5), d.Machine().data[0])
+}
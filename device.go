@@ -0,0 +1,195 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrDeviceRange   = errors.New("device blocks are out of machine data")
+	ErrDeviceOverlap = errors.New("device blocks overlap blocks of another device")
+)
+
+// Device - peripheral mapped by Bus onto range of blocks of machine data.
+// Lifecycle of device is Attach, Start and Stop, each of them is called once.
+type Device interface {
+	// Attach - called when device is mapped, after its blocks are bound to it.
+	// If it fails, blocks are returned to their previous owners.
+	Attach(m *Mapping) error
+
+	// Start - starts device, it is called by Bus.Start.
+	Start() error
+
+	// Stop - stops device and waits for it to finish, it is called by Bus.Stop.
+	Stop() error
+
+	// Store - called by machine after VJ stores v to word i of device memory.
+	// It is called from goroutine running machine, so it must not block.
+	Store(i int, v Word)
+}
+
+// Mapping - blocks of machine data mapped to device.
+type Mapping struct {
+	// Owner - mutex, which owns device blocks in mutex table.
+	Owner sync.RWMutex
+
+	Bus *Bus
+	Dev Device
+
+	// First - index of first word of device memory.
+	First Word
+
+	// Mem - words of device blocks.
+	Mem []Word
+}
+
+// Bus - devices mapped onto blocks of machine data.
+type Bus struct {
+	mac *Machine
+
+	maps []*Mapping
+
+	// blocks - mapping of every block, it is nil for blocks without device.
+	blocks []*Mapping
+}
+
+// NewBus - creates bus of machine. Machine notifies devices of bus about stores to their memory.
+func NewBus(mac *Machine) *Bus {
+	bus := &Bus{mac: mac}
+	mac.bus = bus
+
+	return bus
+}
+
+func (bus *Bus) Machine() *Machine {
+	return bus.mac
+}
+
+// Attach - maps device onto blocks [first, first+blocks) of machine data and binds them to device.
+// Device blocks are readable, writable and shared, they must be owned by machine or unowned.
+// Data must not grow beyond its reserved memory after devices are attached, see Machine.SetMaxBlocks.
+// Blocks are bound by replacing their descriptors in mutex table instead of Machine.Bind,
+// because Bind only appends blocks after the table and can not bind blocks already in it.
+func (bus *Bus) Attach(dev Device, first, blocks int) (*Mapping, error) {
+	g := bus.mac.geom
+	bus.mac.flatten()
+
+	if first < 0 || blocks <= 0 || g.Start(Word(first+blocks)) > Word(len(bus.mac.data)) {
+		return nil, ErrDeviceRange
+	}
+
+	for _, b := range bus.blocks[min(first, len(bus.blocks)):min(first+blocks, len(bus.blocks))] {
+		if b != nil {
+			return nil, ErrDeviceOverlap
+		}
+	}
+
+	m := &Mapping{
+		Bus:   bus,
+		Dev:   dev,
+		First: g.Start(Word(first)),
+		Mem:   bus.mac.data[g.Start(Word(first)):g.Start(Word(first+blocks))],
+	}
+
+	mtab := bus.mac.mtab
+
+	var prev []Block
+
+	if mtab != nil {
+		prev = mtab.Blocks()
+		b := Block{Owner: &m.Owner, Perm: PermRW, Shared: true}
+
+		if err := mtab.claim(&bus.mac.RWMutex, first, blocks, b); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := dev.Attach(m); err != nil {
+		if mtab != nil {
+			mtab.release(first, blocks, prev)
+		}
+
+		return nil, err
+	}
+
+	bus.blocks = growSlice(bus.blocks, max(len(bus.blocks), first+blocks))
+	for i := first; i < first+blocks; i++ {
+		bus.blocks[i] = m
+	}
+
+	bus.maps = append(bus.maps, m)
+
+	return m, nil
+}
+
+// release - returns descriptors of blocks [first, first+blocks) to ones in prev,
+// which is table before blocks were claimed. Blocks appended by claim are removed.
+func (t *MutexTab) release(first, blocks int, prev []Block) {
+	t.update(func(tab []Block) ([]Block, error) {
+		if len(tab) == first+blocks && len(prev) < len(tab) {
+			tab = tab[:len(prev)]
+		}
+
+		for i := first; i < first+blocks && i < len(tab); i++ {
+			tab[i] = Block{}
+			if i < len(prev) {
+				tab[i] = prev[i]
+			}
+		}
+
+		return tab, nil
+	})
+}
+
+// Start - starts devices in order of attachment.
+// If device fails to start, already started devices are stopped.
+func (bus *Bus) Start() error {
+	for i, m := range bus.maps {
+		if err := m.Dev.Start(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				bus.maps[j].Dev.Stop()
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stop - stops devices in reverse order of attachment and returns their errors.
+func (bus *Bus) Stop() error {
+	var errs []error
+
+	for i := len(bus.maps) - 1; i >= 0; i-- {
+		errs = append(errs, bus.maps[i].Dev.Stop())
+	}
+
+	return errors.Join(errs...)
+}
+
+// store - notifies device of word i about store of v.
+func (bus *Bus) store(i, v Word) {
+	b := bus.mac.geom.Block(i)
+	if b >= Word(len(bus.blocks)) {
+		return
+	}
+
+	if m := bus.blocks[b]; m != nil {
+		m.Dev.Store(int(i-m.First), v)
+	}
+}
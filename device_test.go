@@ -0,0 +1,219 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testDevice - device, which records calls of its methods and fails method named fail.
+type testDevice struct {
+	name   string
+	events *[]string
+	fail   string
+	err    error
+	mem    []Word
+}
+
+func (d *testDevice) record(event string) error {
+	*d.events = append(*d.events, d.name+" "+event)
+
+	if strings.HasPrefix(event, d.fail+" ") || event == d.fail {
+		return d.err
+	}
+
+	return nil
+}
+
+func (d *testDevice) Attach(m *Mapping) error {
+	d.mem = m.Mem
+	return d.record("attach " + strconv.Itoa(len(m.Mem)))
+}
+
+func (d *testDevice) Start() error {
+	return d.record("start")
+}
+
+func (d *testDevice) Stop() error {
+	return d.record("stop")
+}
+
+func (d *testDevice) Store(i int, v Word) {
+	d.record("store " + strconv.Itoa(i) + " " + strconv.FormatInt(v, 10))
+}
+
+func TestBus(t *testing.T) {
+	var events []string
+
+	mtab, _ := NewMutexTab(2)
+	mac := NewMachine([]Code{VJ, VJ, VJ, VJ}, []Word{0, 0, 0, 0, 1, 2}, mtab)
+
+	bus := NewBus(mac)
+	dev := &testDevice{name: "dev", events: &events}
+
+	m, err := bus.Attach(dev, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, Word(2), m.First)
+	assert.Equal(t, Block{Owner: &m.Owner, Perm: PermRW, Shared: true}, mtab.Blocks()[1])
+
+	assert.Nil(t, bus.Start())
+
+	_, err = mac.Run()
+	assert.Nil(t, err)
+
+	assert.Nil(t, bus.Stop())
+
+	assert.Equal(t, []string{
+		"dev attach 2",
+		"dev start",
+		"dev store 0 1",
+		"dev store 1 2",
+		"dev stop",
+	}, events)
+	assert.Equal(t, []Word{1, 2}, dev.mem)
+	assert.Equal(t, []Word{3, 2, 1, 2, 1, 2}, mac.data)
+}
+
+func TestBusAttachError(t *testing.T) {
+	var (
+		dev    sync.RWMutex
+		events []string
+	)
+
+	errAttach := errors.New("attach")
+
+	tests := []struct {
+		name   string
+		first  int
+		blocks int
+		err    error
+		expt   error
+
+		// attached - whether Attach of device is called.
+		attached bool
+	}{
+		{
+			name:   "negative first",
+			first:  -1,
+			blocks: 1,
+			expt:   ErrDeviceRange,
+		},
+		{
+			name:   "beyond data",
+			first:  2,
+			blocks: 2,
+			expt:   ErrDeviceRange,
+		},
+		{
+			name:   "overlap",
+			first:  0,
+			blocks: 2,
+			expt:   ErrDeviceOverlap,
+		},
+		{
+			name:   "owned block",
+			first:  2,
+			blocks: 1,
+			expt:   ErrBlockOwned,
+		},
+		{
+			name:   "device error",
+			first:  0,
+			blocks: 1,
+			err:    errAttach,
+			expt:   errAttach,
+
+			attached: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mtab, _ := NewMutexTab(2)
+			mac := NewMachine(nil, make([]Word, 6), mtab)
+			mtab.Blocks()[2].Owner = &dev
+
+			bus := NewBus(mac)
+
+			_, err := bus.Attach(&testDevice{name: "first", events: &events}, 1, 1)
+			assert.Nil(t, err)
+
+			events = nil
+			blocks := mtab.Blocks()
+
+			dev := &testDevice{name: "second", events: &events, fail: "attach", err: test.err}
+
+			_, err = bus.Attach(dev, test.first, test.blocks)
+			assert.Equal(t, test.expt, err)
+			assert.Equal(t, blocks, mtab.Blocks())
+			assert.Equal(t, test.attached, len(events) != 0)
+		})
+	}
+}
+
+func TestBusStartError(t *testing.T) {
+	var events []string
+
+	errStart := errors.New("start")
+
+	mtab, _ := NewMutexTab(2)
+	bus := NewBus(NewMachine(nil, make([]Word, 6), mtab))
+
+	for i, dev := range []*testDevice{
+		{name: "a", events: &events},
+		{name: "b", events: &events},
+		{name: "c", events: &events, fail: "start", err: errStart},
+	} {
+		_, err := bus.Attach(dev, i, 1)
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, errStart, bus.Start())
+	assert.Equal(t, []string{
+		"a attach 2", "b attach 2", "c attach 2",
+		"a start", "b start", "c start",
+		"b stop", "a stop",
+	}, events)
+}
+
+func TestWriterDevice(t *testing.T) {
+	text := "Hi, MAB\n"
+
+	src := &Machine{}
+	ap := NewAsmParser(`+d0#11 "Hi, MAB\n" +d0 +d5 +d0 +d10 :V :V :D'E :V`)
+	assert.Equal(t, nil, ap.Parse(src))
+
+	mtab, _ := NewMutexTab(8)
+	mac := NewMachine(src.code, src.data, mtab)
+
+	buf := bytes.NewBuffer(nil)
+	bus := NewBus(mac)
+
+	_, err := bus.Attach(NewDeviceWriter(buf), 0, 1)
+	assert.Nil(t, err)
+
+	assert.Nil(t, bus.Start())
+	mac.Show()
+	assert.Nil(t, bus.Stop())
+
+	assert.Equal(t, text, buf.String())
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// disasmLineWords - number of data items per line of disassembly.
+const disasmLineWords = 8
+
+// Disassemble - returns canonical assembly of data and code.
+// Data is written as hexadecimal numbers, runs of identical words are compressed with '#'.
+// Code is written one instruction per line.
+// Parsing result with AsmParser reproduces the same code and data.
+func Disassemble(code []Code, data []Word) string {
+	sb := strings.Builder{}
+
+	for i, n := 0, 0; i < len(data); n++ {
+		j := i + 1
+		for j < len(data) && data[j] == data[i] {
+			j++
+		}
+
+		if n%disasmLineWords != 0 {
+			sb.WriteByte(' ')
+		} else if n != 0 {
+			sb.WriteByte('\n')
+		}
+
+		sb.WriteString(disassembleWord(data[i]))
+
+		if j-i > 1 {
+			sb.WriteByte('#')
+			sb.WriteString(strings.ToUpper(strconv.FormatInt(int64(j-i), 16)))
+		}
+
+		i = j
+	}
+
+	if len(data) != 0 {
+		sb.WriteByte('\n')
+	}
+
+	for _, op := range code {
+		sb.WriteString(DisassembleOpcode(op))
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// DisassembleOpcode - returns canonical assembly of single instruction.
+func DisassembleOpcode(op Code) string {
+	b := append(make([]byte, 0, 10), ':', "SDCV"[op&JMask])
+
+	if op&^JMask == 0 {
+		return string(b)
+	}
+
+	b = append(b, '\'')
+	b = appendFlag(b, op, IF, 'I')
+	b = appendFlag(b, op, EF, 'E')
+	b = appendFlag(b, op, MF, 'M')
+
+	if op&(LC|EC|GC) != 0 {
+		b = append(b, '"')
+		b = appendFlag(b, op, LC, 'L')
+		b = appendFlag(b, op, EC, 'E')
+		b = appendFlag(b, op, GC, 'G')
+	}
+
+	return string(b)
+}
+
+func appendFlag(b []byte, op, flag Code, name byte) []byte {
+	if op&flag == flag {
+		return append(b, name)
+	}
+
+	return b
+}
+
+func disassembleWord(w Word) string {
+	if w < 0 {
+		return "-h" + strings.ToUpper(strconv.FormatUint(-uint64(w), 16))
+	}
+
+	return "+h" + strings.ToUpper(strconv.FormatUint(uint64(w), 16))
+}
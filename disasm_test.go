@@ -0,0 +1,83 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   []Code
+		data   []Word
+		expect string
+	}{
+		{
+			name:   "empty",
+			expect: "",
+		},
+		{
+			name:   "opcodes",
+			code:   []Code{VJ, DJ | IF | EF | MF | LC | EC | GC, SJ | EF, CJ | GC, VJ | IF | LC},
+			expect: ":V\n:D'IEM\"LEG\n:S'E\n:C'\"G\n:V'I\"L\n",
+		},
+		{
+			name:   "data",
+			data:   []Word{0xC0FFEE, 0xC0FFEE, 0xC0FFEE, -10, 0, 1, 2, 3, 4, 5, 6, -1 << 63},
+			expect: "+hC0FFEE#3 -hA +h0 +h1 +h2 +h3 +h4 +h5\n+h6 -h8000000000000000\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, Disassemble(test.code, test.data))
+		})
+	}
+}
+
+func FuzzDisassemble(f *testing.F) {
+	f.Add([]byte{VJ, DJ | IF, SJ}, []byte{})
+	f.Add([]byte{0xFF, 0x00, 0x80, 0x7F}, []byte{1, 0, 0, 0, 0, 0, 0, 0x80, 1, 0, 0, 0, 0, 0, 0, 0x80})
+	f.Add([]byte{}, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+
+	f.Fuzz(func(t *testing.T, code []byte, raw []byte) {
+		data := make([]Word, len(raw)/8)
+		for i := range data {
+			data[i] = Word(binary.LittleEndian.Uint64(raw[i*8:]))
+		}
+
+		mac := &Machine{}
+		ap := NewAsmParser(Disassemble(code, data))
+
+		if err := ap.Parse(mac); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, len(code), len(mac.code))
+		assert.Equal(t, len(data), len(mac.data))
+
+		if len(code) != 0 {
+			assert.Equal(t, code, mac.code)
+		}
+
+		if len(data) != 0 {
+			assert.Equal(t, data, mac.data)
+		}
+	})
+}
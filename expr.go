@@ -0,0 +1,218 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+)
+
+// errUnresolved - returned by eval when expression refers to label which is not defined yet.
+var errUnresolved = errors.New("unresolved label")
+
+// expr - node of constant expression.
+// Leaf is value, reference to code label ('@') or reference to data label ('&').
+type expr struct {
+	op   string
+	x, y *expr
+
+	val  Word
+	ref  byte
+	name string
+}
+
+// precedence - binding power of binary operators.
+var precedence = map[string]int{
+	"|":  1,
+	"&":  2,
+	"<<": 3,
+	">>": 3,
+	"+":  4,
+	"-":  4,
+	"*":  5,
+	"/":  5,
+}
+
+// eval - evaluates expression.
+// If final is false, references to undefined labels return errUnresolved.
+func (ap *AsmParser) eval(e *expr, final bool) (Word, error) {
+	switch {
+	case e.ref != 0:
+		l, ok := ap.state().labels[e.name]
+		if ok {
+			return l.index(e.ref == '&'), nil
+		}
+
+		if !final {
+			return 0, errUnresolved
+		}
+
+		return 0, errors.New("undefined label \"" + e.name + "\"")
+	case e.op == "":
+		return e.val, nil
+	case e.op == "neg":
+		x, err := ap.eval(e.x, final)
+		return -x, err
+	}
+
+	x, err := ap.eval(e.x, final)
+	if err != nil {
+		return 0, err
+	}
+
+	y, err := ap.eval(e.y, final)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.op {
+	case "|":
+		return x | y, nil
+	case "&":
+		return x & y, nil
+	case "<<", ">>":
+		if y < 0 {
+			return 0, errors.New("negative shift count")
+		}
+
+		if e.op == "<<" {
+			return x << y, nil
+		}
+
+		return x >> y, nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	}
+
+	if y == 0 {
+		return 0, errors.New("division by zero")
+	}
+
+	return x / y, nil
+}
+
+// parseExpr - parses binary operators with precedence greater than prec.
+func (ap *AsmParser) parseExpr(prec int) (*expr, error) {
+	x, err := ap.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		ap.skipWhitespaces()
+
+		op := ap.peekOperator()
+
+		p, ok := precedence[op]
+		if !ok || p <= prec {
+			return x, nil
+		}
+
+		ap.pos += len(op)
+
+		y, err := ap.parseExpr(p)
+		if err != nil {
+			return nil, err
+		}
+
+		x = &expr{op: op, x: x, y: y}
+	}
+}
+
+func (ap *AsmParser) peekOperator() string {
+	switch cc := ap.currentCharacter(); cc {
+	case '<', '>':
+		if ap.pos+1 < len(ap.src) && ap.src[ap.pos+1] == cc {
+			return ap.src[ap.pos : ap.pos+2]
+		}
+	case '|', '&', '+', '-', '*', '/':
+		return string(cc)
+	}
+
+	return ""
+}
+
+// parseOperand - parses parenthesized expression, number, character literal, label reference,
+// constant name or negation of operand.
+func (ap *AsmParser) parseOperand() (*expr, error) {
+	ap.skipWhitespaces()
+
+	switch cc := ap.currentCharacter(); {
+	case cc == '(':
+		ap.iterateCharacter()
+
+		x, err := ap.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+
+		ap.skipWhitespaces()
+
+		if ap.currentCharacter() != ')' {
+			return nil, ap.buildError("operator", "')'")
+		}
+
+		ap.iterateCharacter()
+
+		return x, nil
+	case cc == '\'':
+		return ap.parseCharacter()
+	case cc == '@' || cc == '&':
+		ap.iterateCharacter()
+
+		name := ap.parseIdentifier()
+		if name == "" {
+			return nil, ap.buildError("label name")
+		}
+
+		return &expr{ref: cc, name: ap.localName(name)}, nil
+	case (cc == '+' || cc == '-' || cc == '~') && baseOf(ap.peekCharacter(1)) != 0 && isDigit(ap.peekCharacter(2)):
+		ap.iterateCharacter()
+
+		base := baseOf(ap.currentCharacter())
+		ap.iterateCharacter()
+
+		val, err := ap.parseSigned(cc, base)
+
+		return &expr{val: val}, err
+	case cc == '-':
+		ap.iterateCharacter()
+
+		x, err := ap.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		return &expr{op: "neg", x: x}, nil
+	case cc >= '0' && cc <= '9':
+		val, err := ap.parseSigned('+', 10)
+		return &expr{val: val}, err
+	case isIdentifierStart(cc):
+		start := ap.pos
+		name := ap.parseIdentifier()
+
+		c, ok := ap.state().consts[name]
+		if !ok {
+			return nil, ap.buildErrorAt(start, "undefined constant \""+name+"\"")
+		}
+
+		return c, nil
+	}
+
+	return nil, ap.buildError("operand")
+}
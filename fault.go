@@ -0,0 +1,114 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// FaultKind - describes why machine can not execute instruction.
+type FaultKind uint8
+
+const (
+	// FaultDataUnderflow - data pointer is lower than first data word.
+	FaultDataUnderflow FaultKind = iota + 1
+
+	// FaultDataOverflow - data pointer is greater than last data word.
+	FaultDataOverflow
+
+	// FaultCodeRange - code pointer is out of code.
+	FaultCodeRange
+
+	// FaultUnownedBlock - destination pointer moves to block which is not in mutex table.
+	FaultUnownedBlock
+
+	// FaultProtection - instruction reads or writes block, which mutex table does not allow machine to access.
+	FaultProtection
+)
+
+var (
+	ErrDataUnderflow = errors.New("data underflow")
+	ErrDataOverflow  = errors.New("data overflow")
+	ErrCodeRange     = errors.New("code pointer out of range")
+	ErrUnownedBlock  = errors.New("unowned block")
+	ErrProtection    = errors.New("protection violation")
+)
+
+var faultErrors = [...]error{
+	FaultDataUnderflow: ErrDataUnderflow,
+	FaultDataOverflow:  ErrDataOverflow,
+	FaultCodeRange:     ErrCodeRange,
+	FaultUnownedBlock:  ErrUnownedBlock,
+	FaultProtection:    ErrProtection,
+}
+
+func (k FaultKind) String() string {
+	if int(k) < len(faultErrors) && faultErrors[k] != nil {
+		return faultErrors[k].Error()
+	}
+
+	return "unknown fault"
+}
+
+// Fault - error returned by checked execution.
+// Contains opcode and pointers as they were before faulted instruction.
+// Source, SrcSource and DstSource describe code, source and destination pointers if machine has source map.
+type Fault struct {
+	Kind FaultKind
+	Op   Code
+
+	CodP Word
+	SrcP Word
+	DstP Word
+
+	Source    string
+	SrcSource string
+	DstSource string
+}
+
+func (f *Fault) Error() string {
+	msg := strings.Join([]string{
+		"fault: ", f.Kind.String(),
+		": op ", strconv.FormatUint(uint64(f.Op), 16),
+		", codP ", strconv.FormatInt(f.CodP, 16),
+		", srcP ", strconv.FormatInt(f.SrcP, 16),
+		", dstP ", strconv.FormatInt(f.DstP, 16),
+	}, "")
+
+	if f.Source != "" {
+		msg += " at " + f.Source
+	}
+
+	if f.SrcSource != "" {
+		msg += ", srcP at " + f.SrcSource
+	}
+
+	if f.DstSource != "" {
+		msg += ", dstP at " + f.DstSource
+	}
+
+	return msg
+}
+
+// Unwrap returns sentinel error of fault kind, so it can be matched with errors.Is.
+func (f *Fault) Unwrap() error {
+	if int(f.Kind) < len(faultErrors) {
+		return faultErrors[f.Kind]
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrForkShared = errors.New("machine with shared blocks, blocks of foreign owners or bus can not be forked")
+
+// pageTab - data of forked machine split into pages of block size,
+// which are shared copy-on-write with other forks.
+// Shared page is never written, so forks may run concurrently.
+type pageTab struct {
+	pages [][]Word
+
+	// own - page is copy of machine, which may be written in place.
+	own []bool
+
+	// words - number of data words.
+	words Word
+}
+
+// split - splits data into shared pages of block size.
+func split(data []Word, g Geometry) *pageTab {
+	size := g.size()
+	n := Word(len(data))
+
+	pt := &pageTab{
+		pages: make([][]Word, (n+size-1)/size),
+		own:   make([]bool, (n+size-1)/size),
+		words: n,
+	}
+
+	for b := range pt.pages {
+		lo, hi := Word(b)*size, min(Word(b+1)*size, n)
+		pt.pages[b] = data[lo:hi:hi]
+	}
+
+	return pt
+}
+
+func (pt *pageTab) load(i Word, g Geometry) Word {
+	return pt.pages[g.Block(i)][i&(g.size()-1)]
+}
+
+// store - writes v to word i, copying its page if it is shared.
+func (pt *pageTab) store(i, v Word, g Geometry) {
+	b := g.Block(i)
+
+	if !pt.own[b] {
+		pt.pages[b] = append([]Word(nil), pt.pages[b]...)
+		pt.own[b] = true
+	}
+
+	pt.pages[b][i&(g.size()-1)] = v
+}
+
+// Fork - returns copy of machine, which shares data blocks with it copy-on-write.
+// Block is copied by machine, which stores to it first, so fork takes time proportional to number of blocks.
+// Fork gets new mutex table with blocks of machine owned by fork, permissions of blocks are kept.
+// Machine with shared blocks, blocks of foreign owners or bus can not be forked.
+// It must not be called while machine is running.
+func (mac *Machine) Fork() (*Machine, error) {
+	if mac.bus != nil || mac.shared() {
+		return nil, ErrForkShared
+	}
+
+	if mac.pt == nil {
+		mac.pt = split(mac.data, mac.geom)
+		mac.data = nil
+	} else {
+		for b := range mac.pt.own {
+			mac.pt.own[b] = false
+		}
+	}
+
+	fork := &Machine{
+		codP: mac.codP,
+		srcP: mac.srcP,
+		dstP: mac.dstP,
+
+		code: mac.code,
+		prog: mac.prog,
+		sup:  mac.sup,
+
+		geom: mac.geom,
+		smap: mac.smap,
+
+		pt: &pageTab{
+			pages: append([][]Word(nil), mac.pt.pages...),
+			own:   make([]bool, len(mac.pt.own)),
+			words: mac.pt.words,
+		},
+
+		haltP:  mac.haltP,
+		status: mac.status,
+		stop:   mac.stop,
+		err:    mac.err,
+
+		growP:     mac.growP,
+		maxBlocks: mac.maxBlocks,
+	}
+
+	fork.state.Store(mac.state.Load())
+
+	if mac.mtab != nil {
+		fork.mtab = mac.mtab.fork(&mac.RWMutex, &fork.RWMutex)
+	}
+
+	return fork, nil
+}
+
+// fork - returns copy of table, where blocks of owner are owned by fork.
+func (t *MutexTab) fork(owner, fork *sync.RWMutex) *MutexTab {
+	res := &MutexTab{blockSize: t.blockSize}
+
+	res.update(func(tab []Block) ([]Block, error) {
+		tab = append(tab, t.Blocks()...)
+
+		for i, b := range tab {
+			if b.Owner == owner {
+				tab[i].Owner = fork
+			}
+		}
+
+		return tab, nil
+	})
+
+	return res
+}
+
+// flatten - copies pages of forked machine into its own data.
+// Memory for maximum number of blocks is reserved like by SetMaxBlocks.
+func (mac *Machine) flatten() {
+	if mac.pt == nil {
+		return
+	}
+
+	g := Geometry{BlockSize: mac.geom.BlockSize, Blocks: mac.maxBlocks}
+	data := make([]Word, 0, max(mac.pt.words, g.Words()-1))
+
+	for _, p := range mac.pt.pages {
+		data = append(data, p...)
+	}
+
+	mac.data = data
+	mac.pt = nil
+}
+
+// Data - returns data words of machine.
+// Forked machine copies blocks shared with other forks, so they are not shared anymore.
+// Data must not be modified while machine is running.
+func (mac *Machine) Data() []Word {
+	mac.flatten()
+	return mac.data
+}
+
+// words - returns number of data words.
+func (mac *Machine) words() Word {
+	if mac.pt != nil {
+		return mac.pt.words
+	}
+
+	return Word(len(mac.data))
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newForkMachine() *Machine {
+	mtab, _ := NewMutexTab(2)
+
+	// stores sum of words 4 and 5 to word 0 and increment of word 3 to word 1
+	return NewMachine([]Code{VJ | EF, VJ}, []Word{0, 0, 0, 0, 1, 2}, mtab)
+}
+
+func TestMachineFork(t *testing.T) {
+	mac := newForkMachine()
+
+	fork, err := mac.Fork()
+	assert.Nil(t, err)
+
+	_, err = fork.Run()
+	assert.Nil(t, err)
+
+	assert.Equal(t, []Word{3, 1, 0, 0, 1, 2}, fork.Data())
+	assert.Equal(t, []Word{0, 0, 0, 0, 1, 2}, mac.Data())
+
+	_, err = mac.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, []Word{3, 1, 0, 0, 1, 2}, mac.Data())
+}
+
+func TestMachineForkCopyOnWrite(t *testing.T) {
+	mac := newForkMachine()
+	fork, _ := mac.Fork()
+
+	assert.Nil(t, fork.Step())
+
+	// only block 0 is copied by fork
+	assert.Equal(t, []bool{true, false, false}, fork.pt.own)
+	assert.Same(t, &mac.pt.pages[1][0], &fork.pt.pages[1][0])
+	assert.NotSame(t, &mac.pt.pages[0][0], &fork.pt.pages[0][0])
+
+	second, _ := fork.Fork()
+	assert.Equal(t, []bool{false, false, false}, fork.pt.own)
+
+	assert.Nil(t, second.Step())
+
+	assert.Equal(t, []Word{3, 0, 0, 0, 1, 2}, fork.Data())
+	assert.Equal(t, []Word{3, 1, 0, 0, 1, 2}, second.Data())
+	assert.Equal(t, []Word{0, 0, 0, 0, 1, 2}, mac.Data())
+}
+
+func TestMachineForkMutexTab(t *testing.T) {
+	mac := newForkMachine()
+	mac.mtab.Protect(0, 1, PermRead)
+	mac.mtab.Blocks()[3] = Block{}
+
+	fork, err := mac.Fork()
+	assert.Nil(t, err)
+
+	assert.NotSame(t, mac.mtab, fork.mtab)
+	assert.Equal(t, Geometry{BlockSize: 2, Blocks: 4}, fork.mtab.Geometry())
+	assert.Equal(t, []Block{
+		{Owner: &fork.RWMutex, Perm: PermRead},
+		{Owner: &fork.RWMutex, Perm: PermRW},
+		{Owner: &fork.RWMutex, Perm: PermRW},
+		{},
+	}, fork.mtab.Blocks())
+	assert.Same(t, &mac.RWMutex, mac.mtab.Blocks()[0].Owner)
+
+	_, err = fork.Run()
+	assert.True(t, errors.Is(err, ErrProtection))
+}
+
+func TestMachineForkShared(t *testing.T) {
+	var dev sync.RWMutex
+
+	mac := newForkMachine()
+	mac.Bind(&dev, 1)
+
+	_, err := mac.Fork()
+	assert.Equal(t, ErrForkShared, err)
+
+	mac = newForkMachine()
+	NewBus(mac)
+
+	_, err = mac.Fork()
+	assert.Equal(t, ErrForkShared, err)
+}
+
+func TestMachineForkState(t *testing.T) {
+	mac := newForkMachine()
+	mac.SetHaltWord(1)
+	mac.SetSourceMap(&SourceMap{})
+
+	assert.Nil(t, mac.Step())
+
+	fork, _ := mac.Fork()
+
+	assert.Equal(t, [4]Word{1, 3, 1, 1}, [4]Word{fork.codP, fork.srcP, fork.dstP, fork.haltP})
+	assert.Same(t, mac.smap, fork.smap)
+	assert.Equal(t, mac.Snapshot(), fork.Snapshot())
+
+	_, err := fork.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, StateHalted, fork.State())
+	assert.Equal(t, Word(1), fork.ExitStatus())
+	assert.NotEqual(t, StateHalted, mac.State())
+}
+
+func TestMachineForkGrow(t *testing.T) {
+	mac := newForkMachine()
+	mac.SetMaxBlocks(5)
+
+	fork, _ := mac.Fork()
+
+	start, err := fork.Grow(1)
+	assert.Nil(t, err)
+	assert.Equal(t, Word(6), start)
+	assert.Nil(t, fork.pt)
+	assert.Equal(t, []Word{0, 0, 0, 0, 1, 2, 0, 0}, fork.data)
+	assert.Equal(t, 9, cap(fork.data))
+}
+
+func TestMachineForkConcurrent(t *testing.T) {
+	mac := newForkMachine()
+
+	var wg sync.WaitGroup
+
+	forks := make([]*Machine, 64)
+	for i := range forks {
+		forks[i], _ = mac.Fork()
+		forks[i].pt.store(5, Word(i), forks[i].geom)
+
+		wg.Add(1)
+		go func(fork *Machine) {
+			defer wg.Done()
+			fork.Run()
+		}(forks[i])
+	}
+
+	wg.Wait()
+
+	for i, fork := range forks {
+		assert.Equal(t, Word(i+1), fork.load(0, false))
+	}
+
+	assert.Equal(t, []Word{0, 0, 0, 0, 1, 2}, mac.Data())
+}
+
+func BenchmarkMachineFork(b *testing.B) {
+	mac := NewMachine([]Code{VJ}, make([]Word, 1<<20), new(MutexTab))
+
+	for i := 0; i < b.N; i++ {
+		fork, _ := mac.Fork()
+		fork.Step()
+	}
+}
@@ -0,0 +1,495 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// fmtLineItems - maximal number of data items on formatted line.
+const fmtLineItems = 8
+
+// fmtTabWidth - width of indentation tab used to align comments.
+const fmtTabWidth = 8
+
+// fmtLine - formatted line, comment is written after code aligned with neighbouring comments.
+type fmtLine struct {
+	code    string
+	comment string
+}
+
+// fmtItem - data item with count, which is merged with identical neighbouring items.
+// Count of number is written in its base, count of expression and character literal is decimal.
+type fmtItem struct {
+	text  string
+	base  int64
+	count uint64
+	merge bool
+}
+
+// FormatAsm - returns assembly source in canonical form:
+// labels and directives start lines, every instruction and macro call is on its own indented line,
+// instruction flags are written in canonical order, numbers are written with uppercase digits without
+// leading zeros and separators, runs of identical data items on line are compressed with '#',
+// trailing comments of consecutive lines are aligned and runs of blank lines are collapsed.
+// Formatting of formatted source returns it unchanged.
+func FormatAsm(src []byte) ([]byte, error) {
+	var (
+		lines []fmtLine
+		errs  ErrorList
+	)
+
+	blank := true
+
+	// parser stops at zero byte like at end of source
+	text, _, _ := strings.Cut(string(src), "\x00")
+
+	for i, text := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		code, comment, hasComment := splitComment(text)
+
+		toks := fmtTokens(code)
+		if len(toks) == 0 && !hasComment {
+			if !blank {
+				lines = append(lines, fmtLine{})
+				blank = true
+			}
+
+			continue
+		}
+
+		blank = false
+
+		if len(toks) == 0 {
+			indent := ""
+			if strings.TrimLeft(text, " \t") != text {
+				indent = "\t"
+			}
+
+			lines = append(lines, fmtLine{code: indent + comment})
+			continue
+		}
+
+		out, err := formatLine(toks, i+1)
+		if err != nil {
+			errs.add(err)
+			out = []fmtLine{{code: strings.TrimRight(code, " \t\r")}}
+		}
+
+		if hasComment {
+			out[len(out)-1].comment = comment
+		}
+
+		lines = append(lines, out...)
+	}
+
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	for len(lines) != 0 && lines[len(lines)-1] == (fmtLine{}) {
+		lines = lines[:len(lines)-1]
+	}
+
+	return writeLines(lines), nil
+}
+
+// splitComment - splits line into code and comment starting with ';' outside of literals.
+func splitComment(text string) (code, comment string, ok bool) {
+	for i := 0; i < len(text); {
+		if end := literalAt(text, i); end >= 0 {
+			i = end
+			continue
+		}
+
+		if text[i] == ';' {
+			return text[:i], strings.TrimRight(text[i:], " \t\r"), true
+		}
+
+		i++
+	}
+
+	return text, "", false
+}
+
+// fmtToken - token of line with its 1-based column.
+type fmtToken struct {
+	text string
+	col  int
+}
+
+// fmtTokens - splits code into tokens separated by spaces outside of parentheses and literals.
+func fmtTokens(code string) []fmtToken {
+	var toks []fmtToken
+
+	for i := 0; i < len(code); {
+		if isVoid(code[i]) {
+			i++
+			continue
+		}
+
+		start, depth := i, 0
+
+		for i < len(code) && (depth > 0 || !isVoid(code[i])) {
+			switch code[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+
+			if end := literalAt(code, i); end >= 0 {
+				i = end
+			} else {
+				i++
+			}
+		}
+
+		toks = append(toks, fmtToken{text: strings.TrimRight(code[start:i], " \t\r\v"), col: start + 1})
+	}
+
+	return toks
+}
+
+// formatLine - formats tokens of source line.
+func formatLine(toks []fmtToken, line int) ([]fmtLine, error) {
+	var (
+		out   []fmtLine
+		items []fmtItem
+	)
+
+	flush := func() {
+		for len(items) != 0 {
+			n := min(len(items), fmtLineItems)
+
+			texts := make([]string, n)
+			for i, it := range items[:n] {
+				texts[i] = it.String()
+			}
+
+			out = append(out, fmtLine{code: "\t" + strings.Join(texts, " ")})
+			items = items[n:]
+		}
+	}
+
+	for i := 0; i < len(toks); i++ {
+		tok, col := toks[i].text, toks[i].col
+
+		switch c := tok[0]; {
+		case c == '.':
+			flush()
+			out = append(out, fmtLine{code: joinTokens(toks[i:])})
+			return out, nil
+		case c == ':':
+			op, err := tok, error(nil)
+			if !hasParamRef(tok) {
+				op, err = formatOpcode(tok, line, col)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			flush()
+			out = append(out, fmtLine{code: "\t" + op})
+		case isIdentifierStart(c) && tok[len(tok)-1] == ':':
+			flush()
+			out = append(out, fmtLine{code: tok})
+		case isIdentifierStart(c):
+			flush()
+			out = append(out, fmtLine{code: "\t" + joinTokens(toks[i:])})
+			return out, nil
+		default:
+			it, err := formatItem(tok, line, col)
+			if err != nil {
+				return nil, err
+			}
+
+			if n := len(items); n != 0 && items[n-1].merges(it) {
+				items[n-1].count += it.count
+			} else {
+				items = append(items, it)
+			}
+		}
+	}
+
+	flush()
+
+	return out, nil
+}
+
+func joinTokens(toks []fmtToken) string {
+	texts := make([]string, len(toks))
+	for i, tok := range toks {
+		texts[i] = tok.text
+	}
+
+	return strings.Join(texts, " ")
+}
+
+// formatOpcode - returns instruction with flags in canonical order.
+func formatOpcode(tok string, line, col int) (string, error) {
+	ap := AsmParser{src: tok}
+	mac := &Machine{}
+
+	if err := ap.parseOpcodeOrNumber(mac); err != nil {
+		return "", relocate(err, line, col)
+	}
+
+	if ap.pos != len(tok) {
+		return "", &AsmError{Line: line, Column: col, Token: tok, Msg: "unexpected \"" + tok + "\": instruction expected"}
+	}
+
+	return DisassembleOpcode(mac.code[0]), nil
+}
+
+// formatItem - parses data item. Number is written in canonical form,
+// and count is split from expression and character literal.
+// Item with macro parameter reference is left unchanged.
+func formatItem(tok string, line, col int) (fmtItem, error) {
+	if hasParamRef(tok) {
+		return fmtItem{text: tok, count: 1}, nil
+	}
+
+	base := int64(0)
+	if len(tok) > 1 {
+		base = baseOf(tok[1])
+	}
+
+	switch c := tok[0]; {
+	case c == '(' || c == '\'':
+		return splitCount(tok), nil
+	case c != '+' && c != '-' && c != '~' || base == 0:
+		return fmtItem{text: tok, count: 1}, nil
+	}
+
+	ap := AsmParser{src: tok, pos: 2}
+
+	val, err := ap.parseSigned(tok[0], base)
+	if err != nil {
+		return fmtItem{}, relocate(err, line, col)
+	}
+
+	it := fmtItem{text: formatNumber(tok[0], base, val), base: base, count: 1, merge: true}
+
+	switch ap.currentCharacter() {
+	case '\x00':
+		return it, nil
+	case '#':
+		ap.iterateCharacter()
+
+		if ap.currentCharacter() == '(' {
+			return fmtItem{text: it.text + tok[ap.pos-1:], count: 1}, nil
+		}
+
+		count, err := ap.parseSigned('+', base)
+		if err == nil && ap.pos != len(tok) {
+			err = ap.buildError("space")
+		}
+
+		if err != nil {
+			return fmtItem{}, relocate(err, line, col)
+		}
+
+		it.count = uint64(count)
+
+		return it, nil
+	}
+
+	return fmtItem{}, relocate(ap.buildError("space", "'#'"), line, col)
+}
+
+// hasParamRef - reports whether token refers to macro parameter "\PARAM" outside of literals.
+func hasParamRef(tok string) bool {
+	for i := 0; i < len(tok); {
+		if end := literalAt(tok, i); end >= 0 {
+			i = end
+			continue
+		}
+
+		if tok[i] == '\\' {
+			return true
+		}
+
+		i++
+	}
+
+	return false
+}
+
+// splitCount - splits decimal count from parenthesized expression or character literal.
+// Item with other count is not merged.
+func splitCount(tok string) fmtItem {
+	end := len(tok)
+
+	if tok[0] == '\'' {
+		end = literalAt(tok, 0)
+	} else {
+		for i, depth := 0, 0; i < len(tok); {
+			switch tok[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+
+			if e := literalAt(tok, i); e >= 0 {
+				i = e
+			} else {
+				i++
+			}
+
+			if depth == 0 {
+				end = i
+				break
+			}
+		}
+	}
+
+	it := fmtItem{text: tok[:end], count: 1, merge: true}
+
+	switch rest := tok[end:]; {
+	case rest == "":
+	case len(rest) > 1 && rest[0] == '#' && isDecimal(rest[1:]):
+		count, err := strconv.ParseUint(rest[1:], 10, 63)
+		if err != nil {
+			return fmtItem{text: tok, count: 1}
+		}
+
+		it.count = count
+	default:
+		return fmtItem{text: tok, count: 1}
+	}
+
+	return it
+}
+
+func isDecimal(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// formatNumber - returns number with sign and base, non-negative number is always written with '+'.
+func formatNumber(sign byte, base int64, val Word) string {
+	mag := uint64(val)
+
+	switch {
+	case val >= 0:
+		sign = '+'
+	case sign == '-':
+		mag = -mag
+	}
+
+	return string(sign) + baseLetter(base) + strings.ToUpper(strconv.FormatUint(mag, int(base)))
+}
+
+func baseLetter(base int64) string {
+	switch base {
+	case 2:
+		return "b"
+	case 8:
+		return "o"
+	case 10:
+		return "d"
+	}
+
+	return "h"
+}
+
+func (it fmtItem) merges(next fmtItem) bool {
+	return it.merge && next.merge && it.text == next.text && it.base == next.base &&
+		it.count+next.count <= math.MaxInt64
+}
+
+func (it fmtItem) String() string {
+	switch {
+	case it.count == 1 && it.merge:
+		return it.text
+	case !it.merge:
+		return it.text
+	case it.base == 0:
+		return it.text + "#" + strconv.FormatUint(it.count, 10)
+	}
+
+	return it.text + "#" + strings.ToUpper(strconv.FormatUint(it.count, int(it.base)))
+}
+
+// relocate - moves error in token to its location in source line.
+func relocate(err error, line, col int) error {
+	var e *AsmError
+	if !errors.As(err, &e) {
+		return err
+	}
+
+	e.Line = line
+	e.Column += col - 1
+	e.Snippet = ""
+
+	return e
+}
+
+// writeLines - writes lines aligning comments of consecutive lines with code.
+func writeLines(lines []fmtLine) []byte {
+	sb := strings.Builder{}
+
+	for i := 0; i < len(lines); {
+		j := i + 1
+		width := 0
+
+		if lines[i].comment != "" {
+			for j = i; j < len(lines) && lines[j].comment != "" && lines[j].code != ""; j++ {
+				width = max(width, codeWidth(lines[j].code))
+			}
+
+			if j == i {
+				j = i + 1
+			}
+		}
+
+		for _, l := range lines[i:j] {
+			sb.WriteString(l.code)
+
+			if l.comment != "" {
+				if l.code != "" {
+					sb.WriteString(strings.Repeat(" ", width-codeWidth(l.code)+1))
+				}
+
+				sb.WriteString(l.comment)
+			}
+
+			sb.WriteByte('\n')
+		}
+
+		i = j
+	}
+
+	return []byte(sb.String())
+}
+
+// codeWidth - returns width of code, which may be indented with single tab.
+func codeWidth(code string) int {
+	if strings.HasPrefix(code, "\t") {
+		return fmtTabWidth + len(code) - 1
+	}
+
+	return len(code)
+}
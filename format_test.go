@@ -0,0 +1,195 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatAsm(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect string
+	}{
+		{
+			name:   "instructions",
+			source: ":V'E\" :C'\"G   :D'IE\"\n:S'",
+			expect: "\t:V'E\n\t:C'\"G\n\t:D'IE\n\t:S\n",
+		},
+		{
+			name:   "empty flag sections",
+			source: `:C"" "00"z :V""L`,
+			expect: "\t:C\n\t\"00\"z\n\t:V'\"L\n",
+		},
+		{
+			name:   "numbers",
+			source: "+hff +d0001_000 -d0 ~hFFFFFFFFFFFFFFFF ~d5 -o17#12 +hA#a",
+			expect: "\t+hFF +d1000 +d0 ~hFFFFFFFFFFFFFFFF +d5 -o17#12 +hA#A\n",
+		},
+		{
+			name:   "compression",
+			source: "+d1 +d1#2 +d01 +h1 (x) (x)#3 'a' 'a' &x &x +d0#(N) +d0#(N)",
+			expect: "\t+d1#4 +h1 (x)#4 'a'#2 &x &x +d0#(N) +d0#(N)\n",
+		},
+		{
+			name:   "wrapping",
+			source: "+d1 +d2 +d3 +d4 +d5 +d6 +d7 +d8 +d9",
+			expect: "\t+d1 +d2 +d3 +d4 +d5 +d6 +d7 +d8\n\t+d9\n",
+		},
+		{
+			name:   "labels and directives",
+			source: "  .equ   N  (1 +  2)\nstart: +d1 loop:   :V\n .include   \"lib.asm\"",
+			expect: ".equ N (1 +  2)\nstart:\n\t+d1\nloop:\n\t:V\n.include \"lib.asm\"\n",
+		},
+		{
+			name:   "macro",
+			source: ".macro add k\n \\k :V'E\n.endm\n  add   (1 + 2)",
+			expect: ".macro add k\n\t\\k\n\t:V'E\n.endm\n\tadd (1 + 2)\n",
+		},
+		{
+			name:   "macro parameter in item",
+			source: ".macro addk k\n\t+d\\k\n\t:V\n.endm\n\taddk 3",
+			expect: ".macro addk k\n\t+d\\k\n\t:V\n.endm\n\taddk 3\n",
+		},
+		{
+			name:   "macro parameter in instruction",
+			source: ".macro jmp f\n :V'\\f +d1 (\\f)#2\n.endm",
+			expect: ".macro jmp f\n\t:V'\\f\n\t+d1 (\\f)#2\n.endm\n",
+		},
+		{
+			name:   "comments",
+			source: "; program\n:V ; first\n  +d1 +d2 ; second\nend:   ; third\n\n  ; indented\n\"a;b\" ; fourth",
+			expect: "; program\n\t:V      ; first\n\t+d1 +d2 ; second\nend:            ; third\n\n\t; indented\n\t\"a;b\" ; fourth\n",
+		},
+		{
+			name:   "blank lines",
+			source: "\n\n+d1\n\n\n\n:V\n\n\n",
+			expect: "\t+d1\n\n\t:V\n",
+		},
+		{
+			name:   "carriage returns",
+			source: "+d1\r\n:V\r\n",
+			expect: "\t+d1\n\t:V\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := FormatAsm([]byte(tt.source))
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.expect, string(res))
+
+			again, err := FormatAsm(res)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, string(res), string(again))
+		})
+	}
+}
+
+func TestFormatAsmPreservesProgram(t *testing.T) {
+	sources := []string{
+		"+d1 +d1#2 +hA#2 (1 + 2) (1 + 2)#3 '\\n' '\\n' \"Hi, MAB\\n\"z\n:V'E\" :C'I\"LG\nend: &end @end",
+		".equ N +d3\n.macro m k ; comment\nagain: (\\k)#N @back>again :V\nback: :C'E\n.endm\n m +d1\n  m (N * 2)",
+		"-d5 -d5 ~h8000000000000000 +b1_0 +b10#10 +o7#(2 + 1)",
+	}
+
+	for _, src := range sources {
+		res, err := FormatAsm([]byte(src))
+		assert.Equal(t, nil, err)
+
+		expect, actual := &Machine{}, &Machine{}
+
+		ap := NewAsmParser(src)
+		assert.Equal(t, nil, ap.Parse(expect))
+
+		ap = NewAsmParser(string(res))
+		assert.Equal(t, nil, ap.Parse(actual))
+
+		assert.Equal(t, expect, actual, string(res))
+	}
+}
+
+func TestFormatAsmError(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect string
+	}{
+		{
+			name:   "instruction",
+			source: "+d1\n  +d2 :X",
+			expect: `2:8: unexpected "X": 'S', 'D', 'C' or 'V' expected`,
+		},
+		{
+			name:   "flags",
+			source: ":V'Q",
+			expect: `1:4: unexpected "Q": flag sequence ('I' - 'E' - 'M' - 'L' - 'E' - 'G') expected`,
+		},
+		{
+			name:   "number",
+			source: "+d1 +d99999999999999999999",
+			expect: "1:7: number out of range",
+		},
+		{
+			name:   "count",
+			source: "+d1#2x +hG",
+			expect: `1:6: unexpected "x": space expected`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FormatAsm([]byte(tt.source))
+			assert.EqualError(t, err, tt.expect)
+		})
+	}
+}
+
+func FuzzFormatAsm(f *testing.F) {
+	f.Add("; program\n+d1 +d1 loop: :V'E\" (1 + 2)#3 ; data\n.macro m k\n\\k\n.endm\n m +d1")
+	f.Add("\"a;b\"z 'c' &x>y @a>b +hff#a ~hFF")
+
+	f.Add(`:C"" "00"z`)
+	f.Add(".macro addk k\n\t+d\\k\n\t:V\n.endm\n\taddk 3")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		mac := &Machine{}
+		ap := NewAsmParser(src)
+		parseErr := ap.Parse(mac)
+
+		res, err := FormatAsm([]byte(src))
+		if err != nil {
+			assert.NotNil(t, parseErr, "source, which parses, is not formatted: %v", err)
+			return
+		}
+
+		again, err := FormatAsm(res)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, string(res), string(again))
+
+		if parseErr != nil {
+			return
+		}
+
+		fmac := &Machine{}
+		fap := NewAsmParser(string(res))
+		assert.Equal(t, nil, fap.Parse(fmac))
+		assert.Equal(t, mac.code, fmac.code)
+		assert.Equal(t, mac.data, fmac.data)
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+// maxFused - maximal number of instructions in superinstruction.
+const maxFused = 64
+
+// superinst - straight-line sequence of SJ, DJ and VJ instructions without EF, MF and conditional flags.
+// Such instructions never skip and their offsets are known at compile time,
+// so whole sequence is executed as stores with offsets relative to pointers before it.
+type superinst struct {
+	// n - number of fused instructions.
+	n Word
+
+	stores []fusedStore
+
+	// src, dst - pointer increments after sequence.
+	src, dst Word
+
+	// srcLo, srcHi, dstLo, dstHi - bounds of pointer offsets before each fused instruction.
+	srcLo, srcHi Word
+	dstLo, dstHi Word
+}
+
+// fusedStore - VJ instruction: data[dstP+dst] = data[srcP+src] + k.
+type fusedStore struct {
+	dst, src, k Word
+}
+
+func fusible(in *inst) bool {
+	return in.jump != CJ && !in.ext && !in.mutex && !in.cond
+}
+
+// fuse - returns superinstructions indexed by code pointer of their first instruction.
+// Sequences shorter than 2 instructions are not fused.
+// Jump into middle of sequence executes rest of it unfused.
+func fuse(prog []inst) []*superinst {
+	sup := make([]*superinst, len(prog))
+
+	for i := 0; i < len(prog); {
+		j := i
+		for j < len(prog) && j-i < maxFused && fusible(&prog[j]) {
+			j++
+		}
+
+		if j-i > 1 {
+			sup[i] = fuseSequence(prog[i:j])
+		}
+
+		i = max(j, i+1)
+	}
+
+	return sup
+}
+
+func fuseSequence(seq []inst) *superinst {
+	s := &superinst{n: Word(len(seq))}
+
+	for i := range seq {
+		s.srcLo, s.srcHi = min(s.srcLo, s.src), max(s.srcHi, s.src)
+		s.dstLo, s.dstHi = min(s.dstLo, s.dst), max(s.dstHi, s.dst)
+
+		switch seq[i].jump {
+		case SJ:
+			s.src += seq[i].sign
+		case DJ:
+			s.dst += seq[i].sign
+		case VJ:
+			s.stores = append(s.stores, fusedStore{dst: s.dst, src: s.src, k: seq[i].sign})
+			s.src--
+			s.dst++
+		}
+	}
+
+	return s
+}
+
+// superprogram - returns superinstructions of compiled code.
+func (mac *Machine) superprogram() []*superinst {
+	if len(mac.sup) != len(mac.program()) {
+		mac.sup = fuse(mac.prog)
+	}
+
+	return mac.sup
+}
+
+// execFused - executes superinstruction if none of its instructions faults or stores to halt or grow word.
+// Must be used only for machine which has no shared blocks, it is never used for forked machine.
+func (mac *Machine) execFused(s *superinst) bool {
+	n := Word(len(mac.data))
+
+	if mac.pt != nil ||
+		mac.srcP+s.srcLo < 0 || mac.srcP+s.srcHi >= n ||
+		mac.dstP+s.dstLo < 0 || mac.dstP+s.dstHi >= n ||
+		mac.geom.Block(mac.dstP+s.dstHi+1) >= Word(len(mac.mtab.Blocks())) ||
+		mac.haltP >= mac.dstP+s.dstLo && mac.haltP <= mac.dstP+s.dstHi ||
+		mac.growP >= mac.dstP+s.dstLo && mac.growP <= mac.dstP+s.dstHi {
+		return false
+	}
+
+	for _, st := range s.stores {
+		mac.data[mac.dstP+st.dst] = mac.data[mac.srcP+st.src] + st.k
+	}
+
+	mac.srcP += s.src
+	mac.dstP += s.dst
+	mac.codP += s.n
+
+	return true
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuse(t *testing.T) {
+	sup := fuse(compile([]Code{VJ, DJ | IF, SJ, CJ, VJ, VJ | EF, SJ | IF, DJ}))
+
+	assert.Equal(t, &superinst{
+		n:      3,
+		stores: []fusedStore{{dst: 0, src: 0, k: 1}},
+		src:    0,
+		dst:    0,
+		srcLo:  -1,
+		dstHi:  1,
+	}, sup[0])
+	assert.Equal(t, []*superinst{nil, nil, nil, nil, nil}, sup[1:6])
+	assert.Equal(t, Word(2), sup[6].n)
+}
+
+func TestFuseDifferential(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+
+	for n := 0; n < 1000; n++ {
+		mac := randomMachine(r, 1+r.Intn(24), 1+r.Intn(48))
+
+		for i := range mac.code {
+			if r.Intn(4) != 0 {
+				mac.code[i] &^= EF | LC | EC | GC
+			}
+		}
+
+		mac.srcP, mac.dstP = r.Int63n(int64(len(mac.data))), r.Int63n(int64(len(mac.data)))
+		mac.SetHaltWord(r.Int63n(int64(len(mac.data))) - 1)
+
+		ref := cloneMachine(mac)
+		ref.haltP = mac.haltP
+
+		opts := RunOptions{MaxTicks: uint64(1 + r.Intn(300))}
+
+		res, err := ref.RunContext(context.Background(), opts)
+
+		opts.Fuse = true
+		fres, ferr := mac.RunContext(context.Background(), opts)
+
+		assert.Equal(t, err, ferr)
+		assert.Equal(t, res, fres)
+		assert.Equal(t, ref.data, mac.data)
+		assert.Equal(t, [3]Word{ref.codP, ref.srcP, ref.dstP}, [3]Word{mac.codP, mac.srcP, mac.dstP})
+	}
+}
+
+func BenchmarkMachineRunFused(b *testing.B) {
+	mac := NewMachine(
+		[]Code{VJ, DJ | IF, SJ, VJ, DJ | IF, SJ, VJ, DJ | IF, SJ, VJ, DJ | IF, SJ},
+		[]Word{0, 123},
+		new(MutexTab),
+	)
+
+	for i := 0; i < b.N; i++ {
+		mac.setState(StateReady)
+		mac.codP = 0
+		mac.RunContext(context.Background(), RunOptions{Fuse: true})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"math/bits"
+)
+
+var ErrBlockSize = errors.New("block size is not power of two")
+
+// Geometry - layout of data memory: size of block in words, which is power of two, and number of blocks.
+// Zero BlockSize means BlockSize constant.
+type Geometry struct {
+	BlockSize Word
+	Blocks    int
+}
+
+// NewGeometry - returns geometry of memory of words with blocks of blockSize words.
+// Memory has one block more than needed for its words, if words fill whole blocks.
+func NewGeometry(blockSize Word, words int) (Geometry, error) {
+	if blockSize <= 0 || blockSize&(blockSize-1) != 0 {
+		return Geometry{}, ErrBlockSize
+	}
+
+	g := Geometry{BlockSize: blockSize}
+	g.Blocks = g.cover(words)
+
+	return g, nil
+}
+
+// size - returns block size in words.
+func (g Geometry) size() Word {
+	if g.BlockSize == 0 {
+		return BlockSize
+	}
+
+	return g.BlockSize
+}
+
+// Block - returns index of block containing non-negative word p.
+func (g Geometry) Block(p Word) Word {
+	return p >> bits.TrailingZeros64(uint64(g.size()))
+}
+
+// Start - returns index of first word of block.
+func (g Geometry) Start(block Word) Word {
+	return block * g.size()
+}
+
+// Words - returns number of words in all blocks.
+func (g Geometry) Words() Word {
+	return Word(g.Blocks) * g.size()
+}
+
+// cover - returns number of blocks, which cover words and word after them.
+func (g Geometry) cover(words int) int {
+	return int(g.Block(Word(words))) + 1
+}
+
+// NewMutexTab - creates empty mutex table with blocks of blockSize words.
+func NewMutexTab(blockSize Word) (*MutexTab, error) {
+	if _, err := NewGeometry(blockSize, 0); err != nil {
+		return nil, err
+	}
+
+	return &MutexTab{blockSize: blockSize}, nil
+}
+
+// Geometry - returns block size of table and number of its blocks.
+func (t *MutexTab) Geometry() Geometry {
+	return Geometry{BlockSize: Geometry{BlockSize: t.blockSize}.size(), Blocks: len(t.Blocks())}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGeometry(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  Word
+		words int
+		expt  Geometry
+		err   error
+	}{
+		{
+			name:  "partial block",
+			size:  4,
+			words: 10,
+			expt:  Geometry{BlockSize: 4, Blocks: 3},
+		},
+		{
+			name:  "whole blocks",
+			size:  4,
+			words: 8,
+			expt:  Geometry{BlockSize: 4, Blocks: 3},
+		},
+		{
+			name:  "single word blocks",
+			size:  1,
+			words: 2,
+			expt:  Geometry{BlockSize: 1, Blocks: 3},
+		},
+		{
+			name: "zero size",
+			err:  ErrBlockSize,
+		},
+		{
+			name: "not power of two",
+			size: 6,
+			err:  ErrBlockSize,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := NewGeometry(test.size, test.words)
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.expt, g)
+		})
+	}
+}
+
+func TestGeometry(t *testing.T) {
+	g := Geometry{BlockSize: 8, Blocks: 2}
+
+	assert.Equal(t, Word(0), g.Block(7))
+	assert.Equal(t, Word(1), g.Block(8))
+	assert.Equal(t, Word(16), g.Start(2))
+	assert.Equal(t, Word(16), g.Words())
+
+	assert.Equal(t, Word(1), Geometry{}.Block(BlockSize))
+}
+
+func TestMachineGeometry(t *testing.T) {
+	mtab, err := NewMutexTab(4)
+	assert.Nil(t, err)
+
+	mac := NewMachine([]Code{VJ}, make([]Word, 10), mtab)
+
+	assert.Equal(t, Geometry{BlockSize: 4, Blocks: 3}, mac.Geometry())
+	assert.Equal(t, Geometry{BlockSize: 4, Blocks: 3}, mtab.Geometry())
+
+	_, err = NewMutexTab(3)
+	assert.Equal(t, ErrBlockSize, err)
+}
+
+func TestMachineSmallBlocks(t *testing.T) {
+	var dev sync.RWMutex
+
+	mtab, _ := NewMutexTab(2)
+	mac := NewMachine([]Code{VJ, VJ, VJ}, []Word{0, 0, 0, 7}, mtab)
+
+	// block 0 contains words 0 and 1
+	mtab.Blocks()[0] = Block{Owner: &dev, Perm: PermRW}
+
+	assert.Equal(t, &Fault{Kind: FaultProtection, Op: VJ, SrcP: 3}, mac.Step())
+
+	mtab.Blocks()[0].Shared = true
+	assert.Nil(t, mac.Step())
+
+	mtab.Protect(0, 1, PermRead)
+	assert.True(t, errors.Is(mac.Step(), ErrProtection))
+
+	assert.Equal(t, []Word{8, 0, 0, 7}, mac.data)
+}
+
+func TestMachineDumpGeometry(t *testing.T) {
+	mtab, _ := NewMutexTab(2)
+	mac := NewMachine([]Code{VJ}, []Word{0, 0, 0}, mtab)
+	mtab.Protect(1, 1, PermRead)
+
+	buf := bytes.NewBuffer(nil)
+	w := bufio.NewWriter(buf)
+	mac.codP = 1
+	mac.Dump(w)
+	w.Flush()
+
+	assert.Contains(t, buf.String(), "\nGeometry: 2 blocks of 2 words\n")
+	assert.Contains(t, buf.String(), "\n\tBlock[0]: own read write\n\tWord[0]: 0\n\tWord[1]: 0\n")
+	assert.Contains(t, buf.String(), "\n\tBlock[1]: own read\n\tWord[2]: 0\n")
+}
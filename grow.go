@@ -0,0 +1,117 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrGrowLimit  = errors.New("data memory limit exceeded")
+	ErrBlockOwned = errors.New("block is owned by someone else")
+)
+
+// SetGrowWord - sets index of grow word.
+// When VJ stores positive number n to grow word, machine grows data by n blocks like Grow
+// and replaces stored value with index of first new word or -1 if data can not grow.
+// Negative index disables grow word.
+func (mac *Machine) SetGrowWord(i Word) {
+	mac.growP = i
+}
+
+// SetMaxBlocks - sets maximum number of blocks of machine data and reserves memory for them,
+// so growing data never moves its words. It must be called before data is shared.
+// Memory of forked machine is reserved when it grows.
+// Maximum is number of blocks of initial data by default.
+func (mac *Machine) SetMaxBlocks(blocks int) {
+	mac.maxBlocks = blocks
+
+	if mac.pt != nil {
+		return
+	}
+
+	g := Geometry{BlockSize: mac.geom.BlockSize, Blocks: blocks}
+
+	if words := g.Words() - 1; words > Word(cap(mac.data)) {
+		mac.data = append(make([]Word, 0, words), mac.data...)
+	}
+}
+
+// MaxBlocks - returns maximum number of blocks of machine data.
+func (mac *Machine) MaxBlocks() int {
+	return mac.maxBlocks
+}
+
+// Grow - extends data by blocks of zero words and returns index of first new word.
+// Blocks, which cover new words, are bound to machine, blocks of mutex table beyond
+// machine data must be unowned or owned by machine.
+// Mutex table is replaced by grown copy, which is published atomically, so machines sharing it see either old or new table.
+func (mac *Machine) Grow(blocks int) (Word, error) {
+	if blocks < 0 || blocks > mac.maxBlocks-mac.geom.Blocks {
+		return -1, ErrGrowLimit
+	}
+
+	if mac.mtab != nil {
+		own := Block{Owner: &mac.RWMutex, Perm: PermRW}
+
+		if err := mac.mtab.claim(&mac.RWMutex, mac.geom.Blocks, blocks, own); err != nil {
+			return -1, err
+		}
+	}
+
+	mac.flatten()
+
+	start := Word(len(mac.data))
+
+	mac.data = append(mac.data, make([]Word, Word(blocks)*mac.geom.size())...)
+	mac.geom.Blocks += blocks
+
+	return start, nil
+}
+
+// claim - replaces descriptors of blocks [first, first+blocks) with b in copy of table.
+// Blocks must be unowned or owned by prev or owner of b.
+func (t *MutexTab) claim(prev *sync.RWMutex, first, blocks int, b Block) error {
+	return t.update(func(tab []Block) ([]Block, error) {
+		for i := first; i < first+blocks && i < len(tab); i++ {
+			if o := tab[i].Owner; o != nil && o != prev && o != b.Owner {
+				return nil, ErrBlockOwned
+			}
+		}
+
+		tab = growSlice(tab, max(len(tab), first+blocks))
+
+		for i := first; i < first+blocks; i++ {
+			tab[i] = b
+		}
+
+		return tab, nil
+	})
+}
+
+// growRequest - handles store of v to grow word i.
+func (mac *Machine) growRequest(i, v Word, shared bool) {
+	if v <= 0 {
+		return
+	}
+
+	start := Word(-1)
+	if v <= Word(mac.maxBlocks) {
+		start, _ = mac.Grow(int(v))
+	}
+
+	mac.put(i, start, shared)
+}
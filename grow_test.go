@@ -0,0 +1,165 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachineGrow(t *testing.T) {
+	mtab, _ := NewMutexTab(4)
+	mac := NewMachine([]Code{VJ}, []Word{1, 2, 3}, mtab)
+
+	start, err := mac.Grow(1)
+	assert.Equal(t, ErrGrowLimit, err)
+	assert.Equal(t, Word(-1), start)
+
+	mac.SetMaxBlocks(3)
+	first := &mac.data[0]
+
+	start, err = mac.Grow(1)
+	assert.Nil(t, err)
+	assert.Equal(t, Word(3), start)
+	assert.Equal(t, []Word{1, 2, 3, 0, 0, 0, 0}, mac.data)
+	assert.Equal(t, Geometry{BlockSize: 4, Blocks: 2}, mac.Geometry())
+	assert.Equal(t, []Block{{Owner: &mac.RWMutex, Perm: PermRW}, {Owner: &mac.RWMutex, Perm: PermRW}}, mtab.Blocks())
+
+	_, err = mac.Grow(2)
+	assert.Equal(t, ErrGrowLimit, err)
+
+	_, err = mac.Grow(1)
+	assert.Nil(t, err)
+	assert.Same(t, first, &mac.data[0])
+	assert.Len(t, mac.data, 11)
+}
+
+func TestMachineGrowOwnedBlock(t *testing.T) {
+	var dev sync.RWMutex
+
+	mtab, _ := NewMutexTab(2)
+	mac := NewMachine(nil, []Word{0}, mtab)
+	mac.SetMaxBlocks(4)
+
+	mtab.SetBlocks(append(mtab.Blocks(), Block{}, Block{Owner: &dev, Perm: PermRW, Shared: true}))
+
+	_, err := mac.Grow(1)
+	assert.Nil(t, err)
+
+	_, err = mac.Grow(1)
+	assert.Equal(t, ErrBlockOwned, err)
+	assert.Equal(t, []Word{0, 0, 0}, mac.data)
+	assert.Same(t, &dev, mtab.Blocks()[2].Owner)
+}
+
+func TestMachineGrowConcurrent(t *testing.T) {
+	mtab, _ := NewMutexTab(2)
+
+	code := make([]Code, 0, 3000)
+	for len(code) < cap(code) {
+		code = append(code, VJ, DJ|IF, SJ)
+	}
+
+	mac := NewMachine(code, []Word{0, 123}, mtab)
+
+	grow := NewMachine(nil, make([]Word, 4), mtab)
+	grow.SetMaxBlocks(103)
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 100; i++ {
+			_, err := grow.Grow(1)
+			assert.Nil(t, err)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		mac.setState(StateReady)
+		mac.codP = 0
+
+		_, err := mac.Run()
+		assert.Nil(t, err)
+	}
+
+	wg.Wait()
+
+	assert.Len(t, mtab.Blocks(), 103)
+	assert.Equal(t, []Word{124, 123}, mac.data)
+}
+
+func TestMachineGrowWord(t *testing.T) {
+	tests := []struct {
+		name string
+		data []Word
+		max  int
+		expt []Word
+	}{
+		{
+			name: "grow",
+			data: []Word{0, 1},
+			max:  4,
+			expt: []Word{2, 1, 0, 0, 0, 0},
+		},
+		{
+			name: "limit",
+			data: []Word{0, 1},
+			max:  3,
+			expt: []Word{-1, 1},
+		},
+		{
+			name: "no request",
+			data: []Word{0, -1},
+			max:  4,
+			expt: []Word{0, -1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, opts := range []RunOptions{{}, {Fuse: true}} {
+				mtab, _ := NewMutexTab(2)
+				mac := NewMachine([]Code{VJ}, append([]Word(nil), test.data...), mtab)
+				mac.SetGrowWord(0)
+				mac.SetMaxBlocks(test.max)
+
+				_, err := mac.RunContext(context.Background(), opts)
+				assert.Nil(t, err)
+				assert.Equal(t, test.expt, mac.data)
+			}
+		})
+	}
+}
+
+func TestMachineSnapshotGrow(t *testing.T) {
+	mac := NewMachine([]Code{VJ}, []Word{0, 1}, new(MutexTab))
+	mac.SetGrowWord(0)
+	mac.SetMaxBlocks(3)
+
+	res, err := RestoreMachine(mac.Snapshot())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, res.MaxBlocks())
+
+	_, err = res.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, Word(2), res.data[0])
+	assert.Len(t, res.data, 2*BlockSize+2)
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import "errors"
+
+// ErrNoHistory - returned when debugger has no recorded tick to undo.
+var ErrNoHistory = errors.New("no history")
+
+// delta - undo record of single tick: pointers before tick and word overwritten by VJ.
+type delta struct {
+	tick uint64
+
+	codP Word
+	srcP Word
+	dstP Word
+
+	addr Word
+	old  Word
+}
+
+// history - bounded ring buffer of deltas. Oldest delta is overwritten when buffer is full.
+type history struct {
+	buf  []delta
+	head int
+	n    int
+}
+
+func (h *history) push(d delta) {
+	if len(h.buf) == 0 {
+		return
+	}
+
+	h.buf[h.head] = d
+	h.head = (h.head + 1) % len(h.buf)
+	h.n = min(h.n+1, len(h.buf))
+}
+
+func (h *history) pop() (d delta, ok bool) {
+	if h.n == 0 {
+		return d, false
+	}
+
+	h.head = (h.head - 1 + len(h.buf)) % len(h.buf)
+	h.n--
+
+	return h.buf[h.head], true
+}
+
+// at - returns i-th delta counting from newest.
+func (h *history) at(i int) delta {
+	return h.buf[(h.head-1-i+2*len(h.buf))%len(h.buf)]
+}
+
+// RecordHistory - enables recording of undo deltas for last limit ticks.
+// Zero limit disables recording. Previously recorded history is dropped.
+//
+// Only changes made by debugged machine are recorded,
+// words written by other machines are not restored by reverse execution.
+func (d *Debugger) RecordHistory(limit int) {
+	d.hist = history{buf: make([]delta, limit)}
+}
+
+// HistoryLen - returns number of ticks which can be undone.
+func (d *Debugger) HistoryLen() int {
+	return d.hist.n
+}
+
+func (d *Debugger) record(write Word) delta {
+	mac := d.mac
+
+	dt := delta{
+		tick: d.ticks,
+		codP: mac.codP,
+		srcP: mac.srcP,
+		dstP: mac.dstP,
+		addr: -1,
+	}
+
+	if write >= 0 && write < mac.words() {
+		dt.addr = write
+		dt.old = mac.load(write, false)
+	}
+
+	return dt
+}
+
+func (d *Debugger) undo(dt delta) {
+	mac := d.mac
+
+	if dt.addr >= 0 {
+		mac.put(dt.addr, dt.old, false)
+	}
+
+	mac.codP = dt.codP
+	mac.srcP = dt.srcP
+	mac.dstP = dt.dstP
+
+	d.ticks = dt.tick
+	d.resume()
+}
+
+// StepBack - undoes last executed tick.
+func (d *Debugger) StepBack() (Event, error) {
+	dt, ok := d.hist.pop()
+	if !ok {
+		return Event{Reason: StopHistory, CodP: d.mac.codP}, ErrNoHistory
+	}
+
+	d.undo(dt)
+
+	return Event{Reason: StopStep, CodP: d.mac.codP}, nil
+}
+
+// ReverseContinue - undoes ticks until breakpoint or watched write is reached
+// or recorded history is exhausted.
+func (d *Debugger) ReverseContinue() (Event, error) {
+	for {
+		dt, ok := d.hist.pop()
+		if !ok {
+			return Event{Reason: StopHistory, CodP: d.mac.codP}, nil
+		}
+
+		d.undo(dt)
+
+		if ev, ok := d.watched(nil, dt.addr); ok {
+			return ev, nil
+		}
+
+		if _, ok := d.breaks[d.mac.codP]; ok {
+			return Event{Reason: StopBreakpoint, CodP: d.mac.codP}, nil
+		}
+	}
+}
+
+// LastWrite - returns tick number of last recorded tick which wrote to addr.
+func (d *Debugger) LastWrite(addr Word) (tick uint64, ok bool) {
+	for i := 0; i < d.hist.n; i++ {
+		if dt := d.hist.at(i); dt.addr == addr {
+			return dt.tick, true
+		}
+	}
+
+	return 0, false
+}
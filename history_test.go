@@ -0,0 +1,77 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebuggerReverse(t *testing.T) {
+	d := NewDebugger(newDebugMachine())
+	d.RecordHistory(16)
+
+	ev, err := d.Continue()
+	assert.Nil(t, err)
+	assert.Equal(t, StopEnd, ev.Reason)
+	assert.Equal(t, []Word{5, 4, 3, 2, 1, 2, 3, 4}, d.Machine().data)
+
+	tick, ok := d.LastWrite(2)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), tick)
+
+	_, ok = d.LastWrite(5)
+	assert.False(t, ok)
+
+	ev, err = d.StepBack()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopStep, CodP: 3}, ev)
+	assert.Equal(t, StateReady, d.Machine().State())
+	assert.Equal(t, []Word{5, 4, 3, 0, 1, 2, 3, 4}, d.Machine().data)
+
+	d.SetBreakpoint(1)
+
+	ev, err = d.ReverseContinue()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopBreakpoint, CodP: 1}, ev)
+	assert.Equal(t, []Word{5, 0, 0, 0, 1, 2, 3, 4}, d.Machine().data)
+	assert.Equal(t, [3]Word{1, 6, 1}, [3]Word{d.CodP(), d.SrcP(), d.DstP()})
+	assert.Equal(t, uint64(1), d.Ticks())
+
+	ev, err = d.ReverseContinue()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopHistory, CodP: 0}, ev)
+	assert.Equal(t, []Word{0, 0, 0, 0, 1, 2, 3, 4}, d.Machine().data)
+
+	ev, err = d.Continue()
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Reason: StopBreakpoint, CodP: 1}, ev)
+}
+
+func TestDebuggerHistoryLimit(t *testing.T) {
+	d := NewDebugger(newDebugMachine())
+	d.RecordHistory(2)
+
+	d.Continue()
+	assert.Equal(t, 2, d.HistoryLen())
+
+	d.StepBack()
+	d.StepBack()
+
+	_, err := d.StepBack()
+	assert.Equal(t, ErrNoHistory, err)
+	assert.Equal(t, []Word{5, 4, 0, 0, 1, 2, 3, 4}, d.Machine().data)
+}
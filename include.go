@@ -0,0 +1,101 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// NewAsmParserFS - creates parser of file name from fsys.
+// Files included by it are resolved through fsys relative to including file.
+func NewAsmParserFS(fsys fs.FS, name string) (AsmParser, error) {
+	name = path.Clean(name)
+
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return AsmParser{}, err
+	}
+
+	ap := AsmParser{src: string(src), file: name}
+	ap.SetFS(fsys)
+	ap.st.includes = []string{name}
+
+	return ap, nil
+}
+
+// SetFS - sets file system, through which included files are resolved.
+func (ap *AsmParser) SetFS(fsys fs.FS) {
+	ap.state().fsys = fsys
+}
+
+// parseInclude - parses included file in place of directive.
+//
+//	.include "path"
+func (ap *AsmParser) parseInclude(mac *Machine) error {
+	ap.skipSpaces()
+
+	if ap.currentCharacter() != '"' {
+		return ap.buildError("quoted path")
+	}
+
+	text, err := ap.parseQuoted('"')
+	if err != nil {
+		return err
+	}
+
+	name := string(text)
+
+	if !isVoid(ap.currentCharacter()) {
+		return ap.buildError("space")
+	}
+
+	st := ap.state()
+	if st.fsys == nil {
+		return ap.buildLineError("include of \"" + name + "\" requires file system")
+	}
+
+	if ap.file != "" {
+		name = path.Join(path.Dir(ap.file), name)
+	} else {
+		name = path.Clean(name)
+	}
+
+	for i, f := range st.includes {
+		if f == name {
+			chain := append(append([]string(nil), st.includes[i:]...), name)
+			return ap.buildLineError("include cycle: " + strings.Join(chain, " -> "))
+		}
+	}
+
+	src, err := fs.ReadFile(st.fsys, name)
+	if err != nil {
+		return ap.buildLineError(err.Error())
+	}
+
+	sub := AsmParser{
+		src:  string(src),
+		file: name,
+		site: ap.site,
+		st:   st,
+	}
+
+	st.includes = append(st.includes, name)
+	sub.parseAll(mac)
+	st.includes = st.includes[:len(st.includes)-1]
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"embed"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+func TestAsmParserInclude(t *testing.T) {
+	ap, err := NewAsmParserFS(testdata, "testdata/main.asm")
+	assert.Equal(t, nil, err)
+
+	mc := &Machine{}
+
+	assert.Equal(t, nil, ap.Parse(mc))
+	assert.Equal(t, []Code{VJ | EF, VJ | EF}, mc.code)
+	assert.Equal(t, []Word{2, 3}, mc.data)
+}
+
+func TestAsmParserIncludeString(t *testing.T) {
+	ap := NewAsmParser(".include \"lib.asm\"\n\t@end\nend:")
+	ap.SetFS(fstest.MapFS{
+		"lib.asm": {Data: []byte("\t+d1 :V\n")},
+	})
+
+	mc := &Machine{}
+
+	assert.Equal(t, nil, ap.Parse(mc))
+	assert.Equal(t, []Code{VJ}, mc.code)
+	assert.Equal(t, []Word{1, 1}, mc.data)
+}
+
+func TestAsmParserIncludeError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.asm":      {Data: []byte(".include \"a.asm\"\n")},
+		"a.asm":         {Data: []byte("\n.include \"dir/b.asm\"\n")},
+		"dir/b.asm":     {Data: []byte(".include \"../a.asm\"\n")},
+		"bad.asm":       {Data: []byte(".include \"dir/bad.asm\"\n")},
+		"dir/bad.asm":   {Data: []byte("\n\n\t!\n")},
+		"missing.asm":   {Data: []byte(".include \"none.asm\"\n")},
+		"quote.asm":     {Data: []byte(".include lib.asm\n")},
+		"open.asm":      {Data: []byte(".include \"lib.asm\n")},
+		"undef.asm":     {Data: []byte(".include \"dir/undef.asm\"\n")},
+		"dir/undef.asm": {Data: []byte("\t@x\n")},
+	}
+
+	tests := []struct {
+		name   string
+		file   string
+		expect string
+	}{
+		{
+			name:   "cycle",
+			file:   "main.asm",
+			expect: "dir/b.asm:1:1: include cycle: a.asm -> dir/b.asm -> a.asm",
+		},
+		{
+			name:   "error in included file",
+			file:   "bad.asm",
+			expect: "dir/bad.asm:3:2: unexpected \"!\": '+', '-' or '~' expected",
+		},
+		{
+			name:   "missing file",
+			file:   "missing.asm",
+			expect: "missing.asm:1:1: open none.asm: file does not exist",
+		},
+		{
+			name:   "unquoted path",
+			file:   "quote.asm",
+			expect: "quote.asm:1:10: unexpected \"lib.asm\": quoted path expected",
+		},
+		{
+			name:   "unclosed path",
+			file:   "open.asm",
+			expect: "open.asm:1:18: unexpected end of line: '\"' expected",
+		},
+		{
+			name:   "undefined label in included file",
+			file:   "undef.asm",
+			expect: "dir/undef.asm:1:2: undefined label \"x\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ap, err := NewAsmParserFS(fsys, tt.file)
+			assert.Equal(t, nil, err)
+
+			assert.EqualError(t, ap.Parse(&Machine{}), tt.expect)
+		})
+	}
+
+	_, err := NewAsmParserFS(fsys, "none.asm")
+	assert.Error(t, err)
+
+	ap := NewAsmParser(".include \"a.asm\"")
+	assert.EqualError(t, ap.Parse(&Machine{}), "1:1: include of \"a.asm\" requires file system")
+}
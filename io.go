@@ -25,6 +25,9 @@ import (
 // Writer - basic buffered writer interface.
 // If last memory byte is 1 then flushes
 // all memory without last bit to output.
+//
+// Writer polls its memory with Show or works as Device attached to Bus,
+// which flushes memory when machine stores 1 to last word.
 type Writer struct {
 	sync.RWMutex
 
@@ -34,6 +37,12 @@ type Writer struct {
 	rmem []byte
 
 	mtab *MutexTab
+
+	// owner - mutex of writer blocks, which are not locked while writer reads them.
+	owner *sync.RWMutex
+
+	notify chan struct{}
+	done   chan struct{}
 }
 
 func NewWriter(w io.Writer, wm, rm []Word, mtab *MutexTab) *Writer {
@@ -45,32 +54,105 @@ func NewWriter(w io.Writer, wm, rm []Word, mtab *MutexTab) *Writer {
 	}
 }
 
+// NewDeviceWriter - creates writer, which gets its memory when attached to Bus.
+func NewDeviceWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
 func (w *Writer) Blocks() int {
-	return (len(w.wmem) + 1) / BlockSize
+	return int(w.mtab.Geometry().Block(Word(len(w.wmem) + 1)))
 }
 
 func (w *Writer) Show() error {
 	for {
 		synchronize(&w.RWMutex)
+		w.flush()
+	}
+}
+
+// flush - writes requested memory ranges to output if last word is 1.
+func (w *Writer) flush() {
+	if !atomic.CompareAndSwapInt64(&w.wmem[len(w.wmem)-1], 1, 0) {
+		return
+	}
 
-		if atomic.CompareAndSwapInt64(&w.wmem[len(w.wmem)-1], 1, 0) {
-			wr := bufio.NewWriter(w.w)
+	wr := bufio.NewWriter(w.w)
+	g := w.mtab.Geometry()
 
-			for i := 0; i < len(w.wmem)-1 && w.wmem[i+1] != 0; i += 2 {
-				k := w.wmem[i+1]
+	for i := 0; i < len(w.wmem)-1 && w.wmem[i+1] != 0; i += 2 {
+		k := w.wmem[i+1]
 
-				for j := w.wmem[i] / BlockSize; (j-1)*BlockSize <= k; j++ {
-					(*w.mtab)[j].RLock()
-					wr.Write(w.rmem[max(j*BlockSize, w.wmem[i])*8:][:min(k, (j+1)*BlockSize)*8])
-					(*w.mtab)[j].RUnlock()
-				}
+		for j := g.Block(w.wmem[i]); g.Start(j-1) <= k; j++ {
+			owner := w.mtab.Blocks()[j].Owner
+			if owner != w.owner {
+				owner.RLock()
 			}
 
-			wr.Flush()
+			wr.Write(w.rmem[max(g.Start(j), w.wmem[i])*8:][:min(k, g.Start(j+1))*8])
 
-			for i := range w.wmem {
-				w.wmem[i] = 0
+			if owner != w.owner {
+				owner.RUnlock()
 			}
 		}
 	}
+
+	wr.Flush()
+
+	for i := range w.wmem {
+		w.wmem[i] = 0
+	}
+}
+
+// Attach - uses device memory as writer memory and machine data as memory to write.
+func (w *Writer) Attach(m *Mapping) error {
+	mac := m.Bus.Machine()
+
+	w.wmem = m.Mem
+	w.rmem = byteSliceOf(mac.data)
+	w.mtab = mac.mtab
+	w.owner = &m.Owner
+
+	return nil
+}
+
+// Start - starts goroutine, which flushes memory after machine stores to last word.
+func (w *Writer) Start() error {
+	w.notify = make(chan struct{}, 1)
+	w.done = make(chan struct{})
+
+	go func() {
+		defer close(w.done)
+
+		for range w.notify {
+			w.flush()
+		}
+	}()
+
+	return nil
+}
+
+// Stop - stops writer goroutine and flushes memory requested before it.
+// Machine must not store to writer memory after writer is stopped.
+func (w *Writer) Stop() error {
+	if w.notify == nil {
+		return nil
+	}
+
+	close(w.notify)
+	<-w.done
+
+	w.flush()
+
+	return nil
+}
+
+func (w *Writer) Store(i int, v Word) {
+	if i != len(w.wmem)-1 || v != 1 {
+		return
+	}
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
 }
@@ -17,37 +17,91 @@ package mabvm
 import (
 	"bytes"
 	"runtime"
+	"sync"
 	"testing"
-	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// syncBuffer - buffer, which is written by writer goroutine while test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
 func TestWriterRun(t *testing.T) {
-	textB := [8]byte{'H', 'i', ',', ' ', 'M', 'A', 'B', '\n'}
-	textW := *(*Word)(unsafe.Pointer(&textB))
+	text := "Hi, MAB\n"
 
-	mac := NewMachine(
-		[]Code{VJ, VJ, DJ | EF, VJ},
-		append(make([]Word, 8187), textW, 0, 4093, 0, 8186),
-		new(MutexTab),
-	)
+	src := &Machine{}
+	// program stores index and length of text to first words of writer memory and 1 to its last word
+	ap := NewAsmParser(`
+		+d0#(BlockSize-1) flush: +d0
+		text: "Hi, MAB\n" end:
+		+d0 (&flush - 2) (&end - &text - 1) (&text - 1)
+		:V :V :D'E :V
+	`)
+	assert.Equal(t, nil, ap.Parse(src))
+
+	mtab := new(MutexTab)
 
-	buf := bytes.NewBuffer(nil)
-	wrt := NewWriter(buf, mac.data[:4096], mac.data, mac.mtab)
+	buf := new(syncBuffer)
+	wrt := NewWriter(buf, src.data[:4096], src.data, mtab)
+
+	// writer owns block of its memory, machine binds rest of data
+	mtab.SetBlocks([]Block{{Owner: &wrt.RWMutex, Perm: PermRW, Shared: true}})
+	mac := NewMachine(src.code, src.data, mtab)
 
 	go wrt.Show()
 
-	mac.Bind(&wrt.RWMutex, wrt.Blocks())
 	mac.Show()
 
-	for buf.Len() < len(textB) {
+	for len(buf.String()) < len(text) {
 		runtime.Gosched()
 	}
 
 	assert.Equal(
 		t,
-		textB[:],
-		buf.Bytes(),
+		text,
+		buf.String(),
 	)
 }
+
+func TestWriterRunSmallBlocks(t *testing.T) {
+	text := "Hi, MAB\n"
+
+	src := &Machine{}
+	ap := NewAsmParser(`+d0#11 "Hi, MAB\n" +d0 +d5 +d0 +d10 :V :V :D'E :V`)
+	assert.Equal(t, nil, ap.Parse(src))
+
+	mtab, _ := NewMutexTab(8)
+
+	buf := new(syncBuffer)
+	wrt := NewWriter(buf, src.data[:8], src.data, mtab)
+
+	mtab.SetBlocks([]Block{{Owner: &wrt.RWMutex, Perm: PermRW, Shared: true}})
+	mac := NewMachine(src.code, src.data, mtab)
+
+	go wrt.Show()
+
+	mac.Show()
+
+	for len(buf.String()) < len(text) {
+		runtime.Gosched()
+	}
+
+	assert.Equal(t, text, buf.String())
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+// parseString - parses string literal with optional suffix:
+//
+//	"text"  - bytes packed by packString.
+//	"text"z - bytes followed by zero byte.
+//	"text"n - number of bytes followed by packed bytes.
+func (ap *AsmParser) parseString(mac *Machine) error {
+	text, err := ap.parseQuoted('"')
+	if err != nil {
+		return err
+	}
+
+	var words []Word
+
+	switch ap.currentCharacter() {
+	case 'z':
+		ap.iterateCharacter()
+		text = append(text, 0)
+	case 'n':
+		ap.iterateCharacter()
+		words = append(words, Word(len(text)))
+	}
+
+	if !isVoid(ap.currentCharacter()) {
+		return ap.buildError("space", "suffix 'z'", "'n'")
+	}
+
+	words = append(words, packString(text)...)
+
+	if err := ap.checkData(mac, Word(len(words))); err != nil {
+		return err
+	}
+
+	mac.data = append(mac.data, words...)
+
+	return nil
+}
+
+// parseCharacter - parses character literal, which value is its byte.
+func (ap *AsmParser) parseCharacter() (*expr, error) {
+	start := ap.pos
+
+	text, err := ap.parseQuoted('\'')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(text) != 1 {
+		return nil, ap.buildErrorAt(start, "character literal should contain single byte")
+	}
+
+	return &expr{val: Word(text[0])}, nil
+}
+
+// parseQuoted - parses text enclosed in quotes with escapes:
+//
+//	\n \t \r \0 \\ \' \" \xHH
+func (ap *AsmParser) parseQuoted(quote byte) ([]byte, error) {
+	if ap.currentCharacter() != quote {
+		return nil, ap.buildError(string([]byte{'\'', quote, '\''}))
+	}
+
+	ap.iterateCharacter()
+
+	var text []byte
+
+	for cc := ap.currentCharacter(); cc != quote; cc = ap.currentCharacter() {
+		switch cc {
+		case '\n', '\x00':
+			return nil, ap.buildError(string([]byte{'\'', quote, '\''}))
+		case '\\':
+			b, err := ap.parseEscape()
+			if err != nil {
+				return nil, err
+			}
+
+			text = append(text, b)
+		default:
+			ap.iterateCharacter()
+			text = append(text, cc)
+		}
+	}
+
+	ap.iterateCharacter()
+
+	return text, nil
+}
+
+func (ap *AsmParser) parseEscape() (byte, error) {
+	start := ap.pos
+	ap.iterateCharacter()
+
+	cc := ap.currentCharacter()
+	ap.iterateCharacter()
+
+	switch cc {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case '0':
+		return 0, nil
+	case '\\', '\'', '"':
+		return cc, nil
+	case 'x':
+		b := int64(0)
+
+		for i := 0; i < 2; i++ {
+			d := digitOf(ap.currentCharacter())
+			if d >= 16 {
+				return 0, ap.buildError("hexadecimal digit")
+			}
+
+			b = b<<4 | d
+			ap.iterateCharacter()
+		}
+
+		return byte(b), nil
+	}
+
+	return 0, ap.buildErrorAt(start, "unknown escape sequence")
+}
+
+// packString - packs text into words in little-endian order regardless of host:
+// byte i is stored in bits 8*(i%8) to 8*(i%8)+7 of word i/8, last word is padded with zero bytes.
+func packString(text []byte) []Word {
+	words := make([]Word, (len(text)+7)/8)
+
+	for i, b := range text {
+		words[i/8] |= Word(b) << (8 * (i % 8))
+	}
+
+	return words
+}
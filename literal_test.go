@@ -0,0 +1,141 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsmParserLiterals(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect []Word
+	}{
+		{
+			name:   "string",
+			source: `"Hi, MAB\n"`,
+			expect: []Word{0x0A42414D202C6948},
+		},
+		{
+			name:   "padding",
+			source: `"0123456789"`,
+			expect: []Word{0x3736353433323130, 0x3938},
+		},
+		{
+			name:   "empty",
+			source: `"" +d1`,
+			expect: []Word{1},
+		},
+		{
+			name:   "zero terminated",
+			source: `"01234567"z "ab"z`,
+			expect: []Word{0x3736353433323130, 0, 0x6261},
+		},
+		{
+			name:   "length prefixed",
+			source: `"abc"n ""n`,
+			expect: []Word{3, 0x636261, 0},
+		},
+		{
+			name:   "escapes",
+			source: `"\t\r\0\\\'\"\x7f\xFF"`,
+			expect: []Word{-0x0080_DDD8_A3FF_F2F7}, // 0xFF7F22275C000D09
+		},
+		{
+			name:   "comment and quote inside",
+			source: `"; '" ; comment`,
+			expect: []Word{0x27203B},
+		},
+		{
+			name:   "characters",
+			source: `'A' '\n'#2 ('a' - 'A') '"'`,
+			expect: []Word{65, 10, 10, 32, 34},
+		},
+		{
+			name:   "constant",
+			source: ".equ Space ' '\n(Space)",
+			expect: []Word{32},
+		},
+		{
+			name:   "macro",
+			source: ".macro say text\n\t\\text \"\\n\"\n.endm\n\tsay \"Hi, MAB\"",
+			expect: []Word{0x42414D202C6948, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ap := NewAsmParser(tt.source)
+			mc := &Machine{}
+
+			assert.Equal(t, nil, ap.Parse(mc))
+			assert.Equal(t, tt.expect, mc.data)
+		})
+	}
+}
+
+func TestAsmParserLiteralsError(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		expect string
+	}{
+		{
+			name:   "unclosed string",
+			source: "\"abc\n+d1",
+			expect: `1:5: unexpected end of line: '"' expected`,
+		},
+		{
+			name:   "unclosed character",
+			source: "'a",
+			expect: `1:3: unexpected EOF: ''' expected`,
+		},
+		{
+			name:   "suffix",
+			source: `"abc"x`,
+			expect: `1:6: unexpected "x": space, suffix 'z' or 'n' expected`,
+		},
+		{
+			name:   "escape",
+			source: `"a\q"`,
+			expect: `1:3: unknown escape sequence`,
+		},
+		{
+			name:   "hexadecimal escape",
+			source: `"\x4g"`,
+			expect: `1:5: unexpected "g\"": hexadecimal digit expected`,
+		},
+		{
+			name:   "long character",
+			source: `'ab'`,
+			expect: `1:1: character literal should contain single byte`,
+		},
+		{
+			name:   "empty character",
+			source: `''`,
+			expect: `1:1: character literal should contain single byte`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ap := NewAsmParser(tt.source)
+			assert.EqualError(t, ap.Parse(&Machine{}), tt.expect)
+		})
+	}
+}
@@ -16,6 +16,7 @@ package mabvm
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"strconv"
 	"sync"
@@ -32,7 +33,93 @@ type Code = byte
 
 type Word = int64
 
-type MutexTab []*sync.RWMutex
+// Perm - accesses allowed to data block.
+type Perm uint8
+
+const (
+	// PermRead - block may be read.
+	PermRead Perm = 1 << iota
+
+	// PermWrite - block may be written.
+	PermWrite
+
+	PermRW = PermRead | PermWrite
+)
+
+// Block - descriptor of data block in mutex table.
+type Block struct {
+	// Owner - mutex of block owner, it is nil for unowned block.
+	Owner *sync.RWMutex
+
+	// Perm - accesses allowed to machines, which may access block.
+	Perm Perm
+
+	// Shared - block may be accessed by machines, which do not own it.
+	Shared bool
+}
+
+// allows - reports whether machine with mutex m may access block with perm.
+func (b Block) allows(m *sync.RWMutex, perm Perm) bool {
+	return (b.Owner == m || b.Shared) && b.Perm&perm == perm
+}
+
+// MutexTab - descriptors of data blocks, block i contains words [i*size, (i+1)*size).
+// Descriptors are replaced by modified copy, which is published atomically,
+// so machines sharing table may read it while another machine binds or grows its blocks.
+// Zero value is empty table with blocks of BlockSize words.
+type MutexTab struct {
+	// mu - serializes replacements of blocks.
+	mu sync.Mutex
+
+	blockSize Word
+
+	blocks atomic.Pointer[[]Block]
+}
+
+// Blocks - returns descriptors of blocks.
+// They must not be modified in place while table is used by running machines, see SetBlocks.
+func (t *MutexTab) Blocks() []Block {
+	if p := t.blocks.Load(); p != nil {
+		return *p
+	}
+
+	return nil
+}
+
+// SetBlocks - replaces descriptors of blocks.
+func (t *MutexTab) SetBlocks(blocks []Block) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.blocks.Store(&blocks)
+}
+
+// update - replaces descriptors with result of f applied to their copy.
+// Descriptors are not replaced if f returns error.
+func (t *MutexTab) update(f func(tab []Block) ([]Block, error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tab, err := f(append([]Block(nil), t.Blocks()...))
+	if err != nil {
+		return err
+	}
+
+	t.blocks.Store(&tab)
+
+	return nil
+}
+
+// Protect - sets permissions of blocks [first, first+blocks).
+func (t *MutexTab) Protect(first, blocks int, perm Perm) {
+	t.update(func(tab []Block) ([]Block, error) {
+		for i := range tab[first : first+blocks] {
+			tab[first+i].Perm = perm
+		}
+
+		return tab, nil
+	})
+}
 
 type Machine struct {
 	sync.RWMutex
@@ -43,29 +130,74 @@ type Machine struct {
 
 	code []Code
 	data []Word
+	prog []inst
+	sup  []*superinst
+
+	// pt - pages of forked machine, data is nil while they are used.
+	pt *pageTab
 
 	mtab *MutexTab
+	geom Geometry
+	smap *SourceMap
+	bus  *Bus
+
+	state atomic.Uint32
+
+	haltP  Word
+	status Word
+
+	// halted - machine stored to halt word, Show checks it instead of loading state atomically.
+	halted bool
+
+	growP     Word
+	maxBlocks int
+
+	stop StopReason
+	err  error
 }
 
 func NewMachine(code []Code, data []Word, mtab *MutexTab) *Machine {
 	mac := &Machine{
-		srcP: Word(len(data)) - 1,
-		code: code,
-		data: data,
-		mtab: mtab,
+		srcP:  Word(len(data)) - 1,
+		haltP: -1,
+		growP: -1,
+		code:  code,
+		data:  data,
+		mtab:  mtab,
+		geom:  Geometry{BlockSize: mtab.Geometry().BlockSize},
 	}
 
-	mac.Bind(&mac.RWMutex, len(mac.data)>>12-len(*mac.mtab)+1)
+	mac.geom.Blocks = mac.geom.cover(len(data))
+	mac.maxBlocks = mac.geom.Blocks
+	mac.Bind(&mac.RWMutex, mac.geom.Blocks-len(mtab.Blocks()))
 
 	return mac
 }
 
+// Geometry - returns block size of mutex table and number of blocks of machine data.
+func (mac *Machine) Geometry() Geometry {
+	return mac.geom
+}
+
+// Bind - appends blocks owned by m to mutex table, non-positive number of blocks appends nothing.
+// Blocks are readable and writable, blocks of foreign owner are shared,
+// so forked machine copies its data out of blocks shared with other forks.
 func (mac *Machine) Bind(m *sync.RWMutex, blocks int) {
-	*mac.mtab = append(*mac.mtab, make([]*sync.RWMutex, blocks)...)
+	if blocks <= 0 {
+		return
+	}
 
-	for i := range (*mac.mtab)[len(*mac.mtab)-blocks:] {
-		(*mac.mtab)[i] = m
+	if m != &mac.RWMutex {
+		mac.flatten()
 	}
+
+	mac.mtab.update(func(tab []Block) ([]Block, error) {
+		for i := 0; i < blocks; i++ {
+			tab = append(tab, Block{Owner: m, Perm: PermRW, Shared: m != &mac.RWMutex})
+		}
+
+		return tab, nil
+	})
 }
 
 func (mac *Machine) dumpFlag(w *bufio.Writer, f byte, msg string) {
@@ -74,6 +206,41 @@ func (mac *Machine) dumpFlag(w *bufio.Writer, f byte, msg string) {
 	}
 }
 
+// dumpBlock - writes owner, permissions and shared flag of block.
+func (mac *Machine) dumpBlock(w *bufio.Writer, block Word) {
+	w.WriteString("\n\tBlock[")
+	w.WriteString(strconv.FormatInt(block, 16))
+	w.WriteString("]:")
+
+	if mac.mtab == nil || block >= Word(len(mac.mtab.Blocks())) {
+		w.WriteString(" not in mutex table")
+		return
+	}
+
+	b := mac.mtab.Blocks()[block]
+
+	switch b.Owner {
+	case nil:
+		w.WriteString(" unowned")
+	case &mac.RWMutex:
+		w.WriteString(" own")
+	default:
+		w.WriteString(" foreign")
+	}
+
+	if b.Perm&PermRead != 0 {
+		w.WriteString(" read")
+	}
+
+	if b.Perm&PermWrite != 0 {
+		w.WriteString(" write")
+	}
+
+	if b.Shared {
+		w.WriteString(" shared")
+	}
+}
+
 func (mac *Machine) Dump(w *bufio.Writer) {
 	w.WriteString("\n==============================\n")
 
@@ -88,6 +255,8 @@ func (mac *Machine) Dump(w *bufio.Writer) {
 		w.WriteString("VJ: Value Jump")
 	}
 
+	w.WriteString(source(mac.smap.CodeSource(mac.codP - 1)))
+
 	w.WriteString("\nFlags:")
 
 	mac.dumpFlag(w, IF, "\n\tIF: Inversion Flag")
@@ -99,77 +268,198 @@ func (mac *Machine) Dump(w *bufio.Writer) {
 
 	w.WriteString("\ncodP: Code Pointer: ")
 	w.WriteString(strconv.FormatInt(mac.codP, 16))
+	w.WriteString(source(mac.smap.CodeSource(mac.codP)))
 	w.WriteString("\nsrcP: Source Pointer: ")
 	w.WriteString(strconv.FormatInt(mac.srcP, 16))
+	w.WriteString(source(mac.smap.DataSource(mac.srcP)))
 	w.WriteString("\ndstP: Destination Pointer: ")
 	w.WriteString(strconv.FormatInt(mac.dstP, 16))
+	w.WriteString(source(mac.smap.DataSource(mac.dstP)))
+
+	w.WriteString("\nGeometry: ")
+	w.WriteString(strconv.Itoa(mac.geom.Blocks))
+	w.WriteString(" blocks of ")
+	w.WriteString(strconv.FormatInt(mac.geom.size(), 16))
+	w.WriteString(" words")
 
 	w.WriteString("\nData:")
 
-	for i, el := range mac.data {
+	for i := Word(0); i < mac.words(); i++ {
+		if i&(mac.geom.size()-1) == 0 {
+			mac.dumpBlock(w, mac.geom.Block(i))
+		}
+
 		w.WriteString("\n\tWord[")
-		w.WriteString(strconv.FormatInt(int64(i), 16))
+		w.WriteString(strconv.FormatInt(i, 16))
 		w.WriteString("]: ")
-		w.WriteString(strconv.FormatInt(el, 16))
+		w.WriteString(strconv.FormatInt(mac.load(i, false), 16))
 	}
 
 	w.WriteString("\n==============================\n")
 }
 
+// Tick - executes single instruction.
+// It panics with *Fault if instruction accesses block without permission.
 func (mac *Machine) Tick() {
-	op := mac.code[mac.codP]
+	in := decode(mac.code[mac.codP])
+
+	if err := mac.protect(); err != nil {
+		panic(err)
+	}
+
+	mac.exec(&in, true)
+}
 
-	if op&MF == MF {
-		synchronize(&mac.RWMutex)
+func (mac *Machine) fault(kind FaultKind, op Code) error {
+	return &Fault{
+		Kind: kind,
+		Op:   op,
+		CodP: mac.codP,
+		SrcP: mac.srcP,
+		DstP: mac.dstP,
+
+		Source:    mac.smap.CodeSource(mac.codP),
+		SrcSource: mac.smap.DataSource(mac.srcP),
+		DstSource: mac.smap.DataSource(mac.dstP),
 	}
+}
 
-	cc := Word(1)
+func (mac *Machine) checkData(p Word, op Code) error {
+	switch {
+	case p < 0:
+		return mac.fault(FaultDataUnderflow, op)
+	case p >= mac.words():
+		return mac.fault(FaultDataOverflow, op)
+	}
+
+	return nil
+}
+
+func (mac *Machine) check() error {
+	if mac.codP < 0 || mac.codP >= Word(len(mac.code)) {
+		return mac.fault(FaultCodeRange, 0)
+	}
+
+	op := mac.code[mac.codP]
+	srcP := mac.srcP
 
 	if op&EF == EF {
-		cc = atomic.LoadInt64(&mac.data[mac.srcP])
-		mac.srcP--
+		if err := mac.checkData(srcP, op); err != nil {
+			return err
+		}
+
+		srcP--
 	}
 
-	srcD := atomic.LoadInt64(&mac.data[mac.srcP])
-	dstD := atomic.LoadInt64(&mac.data[mac.dstP])
+	if err := mac.checkData(srcP, op); err != nil {
+		return err
+	}
 
-	if int64(op)&GC>>7*srcD >= dstD &&
-		int64(op)&EC>>6*srcD != dstD &&
-		int64(op)&LC>>5*srcD <= dstD {
-		return
+	if err := mac.checkData(mac.dstP, op); err != nil {
+		return err
 	}
 
-	cc -= int64(op) & IF >> 1 * cc
+	if op&JMask == VJ && (mac.mtab == nil || mac.geom.Block(mac.dstP+1) >= Word(len(mac.mtab.Blocks()))) {
+		return mac.fault(FaultUnownedBlock, op)
+	}
 
-	switch op & JMask {
-	case SJ:
-		mac.srcP += cc
-	case DJ:
-		mac.dstP += cc
-	case CJ:
-		mac.codP += cc
-	case VJ:
-		atomic.StoreInt64(&mac.data[mac.dstP], srcD+cc)
-		mac.srcP--
-		mac.dstP++
+	return mac.protect()
+}
+
+// access - reports whether machine may access word p with perm.
+// Words of blocks, which are not in mutex table, are not protected.
+func (mac *Machine) access(p Word, perm Perm) bool {
+	if mac.mtab == nil || p < 0 {
+		return true
+	}
+
+	tab := mac.mtab.Blocks()
+	if mac.geom.Block(p) >= Word(len(tab)) {
+		return true
+	}
+
+	return tab[mac.geom.Block(p)].allows(&mac.RWMutex, perm)
+}
+
+// protect - returns FaultProtection if current instruction reads or writes block without permission.
+func (mac *Machine) protect() error {
+	op := mac.code[mac.codP]
+	srcP := mac.srcP
 
-		dstM := (*mac.mtab)[mac.dstP/BlockSize]
-		if dstM != nil && dstM != &mac.RWMutex {
-			dstM.TryLock()
+	if op&EF == EF {
+		if !mac.access(srcP, PermRead) {
+			return mac.fault(FaultProtection, op)
 		}
+
+		srcP--
+	}
+
+	if op&(LC|EC|GC) != 0 && !(mac.access(srcP, PermRead) && mac.access(mac.dstP, PermRead)) {
+		return mac.fault(FaultProtection, op)
+	}
+
+	if op&JMask == VJ && !(mac.access(srcP, PermRead) && mac.access(mac.dstP, PermWrite)) {
+		return mac.fault(FaultProtection, op)
+	}
+
+	return nil
+}
+
+// Step - executes single instruction like Tick,
+// but returns *Fault instead of panicking on bad pointers.
+func (mac *Machine) Step() error {
+	return mac.step(true)
+}
+
+func (mac *Machine) step(shared bool) error {
+	if err := mac.check(); err != nil {
+		return err
 	}
 
-	mac.codP++
+	mac.exec(&mac.program()[mac.codP], shared)
+	return nil
 }
 
+// Run - executes code from current code pointer until machine halts
+// and returns its exit status.
+// Jump out of code is reported as FaultCodeRange.
+func (mac *Machine) Run() (Word, error) {
+	res, err := mac.RunContext(context.Background(), RunOptions{})
+	return res.Status, err
+}
+
+// Show - executes code from start till its end or halt.
+// It panics with *Fault like Tick if mutex table restricts access of machine.
 func (mac *Machine) Show() {
 	mac.codP = 0
+	mac.halted = false
+	mac.setState(StateRunning)
 
-	for mac.codP < Word(len(mac.code)) {
-		mac.Tick()
+	prog := mac.program()
+	shared := mac.shared()
+	restricted := mac.restricted()
+
+	if !shared && !restricted && mac.pt == nil && mac.bus == nil {
+		mac.execPlain(prog)
+	}
+
+	for mac.codP < Word(len(prog)) && !mac.halted {
+		if restricted {
+			if err := mac.protect(); err != nil {
+				panic(err)
+			}
+		}
+
+		mac.exec(&prog[mac.codP], shared)
+	}
+
+	if !mac.halted {
+		mac.halt(StopEnd, 0)
 	}
 }
 
+// DebugShow - executes code like Show, dumping machine before and after execution
+// and tracing every tick in between as JSON Lines.
 func (mac *Machine) DebugShow(dw io.Writer) {
 	w := bufio.NewWriter(dw)
 	defer w.Flush()
@@ -177,9 +467,22 @@ func (mac *Machine) DebugShow(dw io.Writer) {
 	mac.codP = 1
 	mac.Dump(w)
 	mac.codP = 0
+	mac.setState(StateRunning)
 
-	for mac.codP < Word(len(mac.code)) {
+	tr := NewJSONTracer(w)
+
+	for tick := uint64(0); mac.codP < Word(len(mac.code)) && mac.State() != StateHalted; tick++ {
+		ev, write := mac.beginTrace(tick)
 		mac.Tick()
+		mac.endTrace(&ev, write)
+		tr.Trace(&ev)
+	}
+
+	if mac.State() != StateHalted {
+		mac.halt(StopEnd, 0)
+	}
+
+	if mac.codP <= Word(len(mac.code)) {
 		mac.Dump(w)
 	}
 }
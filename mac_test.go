@@ -15,6 +15,8 @@
 package mabvm
 
 import (
+	"errors"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -62,6 +64,19 @@ func TestMachineRun(t *testing.T) {
 			},
 			expt: []Word{7, 7},
 		},
+		{
+			name: "store to halt word",
+			init: func() *Machine {
+				m := NewMachine(
+					[]Code{DJ, VJ, CJ | IF},
+					[]Word{0, 0, 41},
+					new(MutexTab),
+				)
+				m.SetHaltWord(1)
+				return m
+			},
+			expt: []Word{0, 42, 41},
+		},
 	}
 
 	t.Parallel()
@@ -74,6 +89,169 @@ func TestMachineRun(t *testing.T) {
 	}
 }
 
+func TestMachineRunFault(t *testing.T) {
+	tests := []struct {
+		name string
+		code []Code
+		data []Word
+		expt error
+		kind FaultKind
+	}{
+		{
+			name: "destination underflow",
+			code: []Code{DJ | IF, VJ},
+			data: []Word{0},
+			expt: ErrDataUnderflow,
+			kind: FaultDataUnderflow,
+		},
+		{
+			name: "source overflow",
+			code: []Code{SJ, VJ},
+			data: []Word{0},
+			expt: ErrDataOverflow,
+			kind: FaultDataOverflow,
+		},
+		{
+			name: "extension underflow",
+			code: []Code{VJ | EF},
+			data: []Word{1},
+			expt: ErrDataUnderflow,
+			kind: FaultDataUnderflow,
+		},
+		{
+			name: "jump before code",
+			code: []Code{CJ | IF | EF},
+			data: []Word{0, 5},
+			expt: ErrCodeRange,
+			kind: FaultCodeRange,
+		},
+		{
+			name: "jump past code",
+			code: []Code{CJ | EF},
+			data: []Word{0, 5},
+			expt: ErrCodeRange,
+			kind: FaultCodeRange,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mac := NewMachine(test.code, test.data, new(MutexTab))
+
+			_, err := mac.Run()
+
+			var f *Fault
+			assert.True(t, errors.Is(err, test.expt))
+			assert.True(t, errors.As(err, &f))
+			assert.Equal(t, test.kind, f.Kind)
+		})
+	}
+}
+
+func TestMachineSharedMutexTab(t *testing.T) {
+	mtab, _ := NewMutexTab(4)
+
+	a := NewMachine([]Code{VJ}, []Word{0, 1, 2}, mtab)
+	b := NewMachine([]Code{VJ}, make([]Word, 7), mtab)
+	c := NewMachine([]Code{VJ}, make([]Word, 2), mtab)
+
+	assert.Equal(t, []Block{
+		{Owner: &a.RWMutex, Perm: PermRW},
+		{Owner: &b.RWMutex, Perm: PermRW},
+	}, mtab.Blocks())
+
+	_, err := a.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, []Word{3, 1, 2}, a.data)
+
+	// first block of b and c is owned by a
+	_, err = c.Run()
+	assert.True(t, errors.Is(err, ErrProtection))
+}
+
+func TestMachineStepUnownedBlock(t *testing.T) {
+	mac := NewMachine([]Code{VJ}, []Word{0, 1}, new(MutexTab))
+	mac.mtab.SetBlocks(mac.mtab.Blocks()[:0])
+
+	err := mac.Step()
+
+	assert.True(t, errors.Is(err, ErrUnownedBlock))
+	assert.Equal(t, &Fault{Kind: FaultUnownedBlock, Op: VJ, SrcP: 1}, err)
+	assert.Equal(t, []Word{0, 1}, mac.data)
+}
+
+func TestMachineStepProtection(t *testing.T) {
+	var dev sync.RWMutex
+
+	tests := []struct {
+		name  string
+		code  []Code
+		block Block
+		expt  error
+	}{
+		{
+			name:  "write read-only block",
+			code:  []Code{VJ},
+			block: Block{Perm: PermRead},
+			expt:  &Fault{Kind: FaultProtection, Op: VJ, SrcP: 1},
+		},
+		{
+			name:  "read write-only block",
+			code:  []Code{DJ | EF},
+			block: Block{Perm: PermWrite},
+			expt:  &Fault{Kind: FaultProtection, Op: DJ | EF, SrcP: 1},
+		},
+		{
+			name:  "compare unreadable block",
+			code:  []Code{SJ | EC},
+			block: Block{Perm: PermWrite},
+			expt:  &Fault{Kind: FaultProtection, Op: SJ | EC, SrcP: 1},
+		},
+		{
+			name:  "access unshared foreign block",
+			code:  []Code{VJ},
+			block: Block{Owner: &dev, Perm: PermRW},
+			expt:  &Fault{Kind: FaultProtection, Op: VJ, SrcP: 1},
+		},
+		{
+			name:  "write shared foreign block",
+			code:  []Code{VJ},
+			block: Block{Owner: &dev, Perm: PermRW, Shared: true},
+		},
+		{
+			name:  "jump without access",
+			code:  []Code{CJ},
+			block: Block{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mac := NewMachine(test.code, []Word{0, 1}, new(MutexTab))
+
+			if test.block.Owner == nil {
+				test.block.Owner = &mac.RWMutex
+			}
+
+			mac.mtab.Blocks()[0] = test.block
+
+			assert.Equal(t, test.expt, mac.Step())
+		})
+	}
+}
+
+func TestMachineTickProtection(t *testing.T) {
+	mac := NewMachine([]Code{VJ}, []Word{0, 1}, new(MutexTab))
+	mac.mtab.Protect(0, 1, PermRead)
+
+	assert.PanicsWithError(t, mac.fault(FaultProtection, VJ).Error(), mac.Tick)
+	assert.PanicsWithError(t, mac.fault(FaultProtection, VJ).Error(), mac.Show)
+	assert.Equal(t, []Word{0, 1}, mac.data)
+
+	_, err := mac.Run()
+	assert.True(t, errors.Is(err, ErrProtection))
+}
+
 func BenchmarkMachineRun(b *testing.B) {
 	mac := NewMachine(
 		[]Code{VJ, DJ | IF, SJ, VJ, DJ | IF, SJ, VJ, DJ | IF, SJ, VJ, DJ | IF, SJ},
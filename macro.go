@@ -0,0 +1,304 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxMacroDepth - maximal depth of nested macro expansions.
+// maxMacroExpansions, maxMacroItems - maximal numbers of macro expansions and of items parsed in them
+// by whole source, which stop macros calling each other many times.
+const (
+	maxMacroDepth      = 64
+	maxMacroExpansions = 1 << 16
+	maxMacroItems      = 1 << 20
+)
+
+// macro - parameterized sequence of source lines.
+type macro struct {
+	name   string
+	params []string
+	body   string
+
+	// file, line - location of first body line.
+	file string
+	line int
+
+	// locals - labels defined in body, which are renamed in every expansion.
+	locals []string
+}
+
+// localLabel - matches label definitions in macro body.
+var localLabel = regexp.MustCompile(`(?m)(?:^|\s)([A-Za-z_][A-Za-z0-9_.]*):`)
+
+// parseMacro - parses macro definition:
+//
+//	.macro NAME PARAM...
+//	BODY
+//	.endm
+func (ap *AsmParser) parseMacro() error {
+	ap.skipSpaces()
+
+	at := ap.pos
+
+	m := &macro{name: ap.parseIdentifier(), file: ap.file}
+	if m.name == "" {
+		return ap.buildError("macro name")
+	}
+
+	duplicate := ap.buildErrorAt(at, "duplicate macro \""+m.name+"\"")
+
+	for ap.skipSpaces(); isIdentifierStart(ap.currentCharacter()); ap.skipSpaces() {
+		m.params = append(m.params, ap.parseIdentifier())
+	}
+
+	if cc := ap.currentCharacter(); cc == ';' {
+		ap.skipComment()
+	} else if cc != '\n' {
+		return ap.buildError("parameter name", "end of line")
+	}
+
+	unclosed := ap.buildLineError("macro \"" + m.name + "\" is not closed with .endm")
+
+	ap.iterateCharacter()
+	ap.line++
+
+	m.line = ap.line
+	start := ap.pos
+
+	for {
+		if ap.currentCharacter() == '\x00' {
+			return unclosed
+		}
+
+		lineStart := ap.pos
+		ap.skipComment()
+
+		if text, _, _ := strings.Cut(ap.src[lineStart:ap.pos], ";"); strings.TrimSpace(text) == ".endm" {
+			m.body = ap.src[start:lineStart]
+			break
+		}
+
+		ap.iterateCharacter()
+		ap.line++
+	}
+
+	for _, sm := range localLabel.FindAllStringSubmatch(stripComments(m.body), -1) {
+		m.locals = append(m.locals, sm[1])
+	}
+
+	if _, ok := ap.st.macros[m.name]; ok {
+		return duplicate
+	}
+
+	ap.st.macros[m.name] = m
+
+	return nil
+}
+
+// expand - parses macro call arguments till end of line and parses macro body with substituted parameters.
+// Labels defined in body are local to expansion.
+func (ap *AsmParser) expand(mac *Machine, m *macro) error {
+	call := ap.newError(ap.start, "").Position()
+
+	var args []string
+
+	for ap.skipSpaces(); ap.currentCharacter() != '\n' && ap.currentCharacter() != ';' && ap.currentCharacter() != '\x00'; ap.skipSpaces() {
+		args = append(args, ap.parseArgument())
+	}
+
+	if len(args) != len(m.params) {
+		return ap.buildLineError("macro \"" + m.name + "\" expects " + strconv.Itoa(len(m.params)) +
+			" arguments, got " + strconv.Itoa(len(args)))
+	}
+
+	body, err := m.substitute(args)
+	if err != nil {
+		return ap.buildLineError(err.Error())
+	}
+
+	st := ap.state()
+	if st.depth >= maxMacroDepth {
+		return ap.buildLineError("macro expansion is too deep")
+	}
+
+	st.expansions++
+
+	if st.exhausted() {
+		return ap.budgetError()
+	}
+
+	sub := AsmParser{
+		src:    body,
+		line:   m.line,
+		file:   m.file,
+		site:   ap.site + call + ": in macro \"" + m.name + "\": ",
+		locals: make(map[string]string, len(m.locals)),
+		st:     st,
+	}
+
+	for _, l := range m.locals {
+		sub.locals[l] = m.name + "." + strconv.Itoa(st.expansions) + "." + l
+	}
+
+	st.depth++
+	sub.parseAll(mac)
+	st.depth--
+
+	if st.exhausted() {
+		return ap.budgetError()
+	}
+
+	return nil
+}
+
+// budgetError - returns error about exceeded budget of macro expansions.
+// Only outermost call reports it, nested calls stop silently.
+func (ap *AsmParser) budgetError() error {
+	switch {
+	case ap.st.depth > 0:
+		return nil
+	case ap.st.items > maxMacroItems:
+		return ap.buildLineError("macro expansions exceed limit of " + strconv.Itoa(maxMacroItems) + " items")
+	}
+
+	return ap.buildLineError("macro expansions exceed limit of " + strconv.Itoa(maxMacroExpansions) + " calls")
+}
+
+// parseArgument - parses macro argument, which ends with space outside of parentheses and literals.
+func (ap *AsmParser) parseArgument() string {
+	start := ap.pos
+	depth := 0
+
+	for cc := ap.currentCharacter(); cc != '\x00' && cc != '\n' && (depth > 0 || !isVoid(cc) && cc != ';'); cc = ap.currentCharacter() {
+		switch cc {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+
+		if end := literalAt(ap.src, ap.pos); end >= 0 {
+			ap.pos = end
+		} else {
+			ap.iterateCharacter()
+		}
+	}
+
+	return ap.src[start:ap.pos]
+}
+
+// substitute - replaces parameter references "\PARAM" in body with arguments.
+// Character and string literals are copied as is.
+func (m *macro) substitute(args []string) (string, error) {
+	sb := strings.Builder{}
+
+	for body := m.body; ; {
+		i := 0
+		for i < len(body) && body[i] != '\\' {
+			if end := literalAt(body, i); end >= 0 {
+				i = end
+			} else {
+				i++
+			}
+		}
+
+		sb.WriteString(body[:i])
+
+		if i == len(body) {
+			return sb.String(), nil
+		}
+
+		body = body[i+1:]
+
+		j := 0
+		for j < len(body) && (isIdentifierStart(body[j]) || body[j] >= '0' && body[j] <= '9') {
+			j++
+		}
+
+		k := 0
+		for k < len(m.params) && m.params[k] != body[:j] {
+			k++
+		}
+
+		if k == len(m.params) {
+			return "", errors.New("macro \"" + m.name + "\" has no parameter \"" + body[:j] + "\"")
+		}
+
+		sb.WriteString(args[k])
+		body = body[j:]
+	}
+}
+
+// literalAt - returns end of character or string literal starting at i, or -1 if there is none.
+// Quote after letter or another quote is part of instruction flags.
+func literalAt(src string, i int) int {
+	if c := src[i]; c != '"' && c != '\'' || i > 0 && (isIdentifierStart(src[i-1]) || src[i-1] == '\'' || src[i-1] == '"') {
+		return -1
+	}
+
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case src[i]:
+			return j + 1
+		case '\n':
+			return j
+		}
+	}
+
+	return len(src)
+}
+
+// localName - returns name of label in current macro expansion.
+func (ap *AsmParser) localName(name string) string {
+	if local, ok := ap.locals[name]; ok {
+		return local
+	}
+
+	return name
+}
+
+func (ap *AsmParser) skipSpaces() {
+	for cc := ap.currentCharacter(); cc == ' ' || cc == '\t' || cc == '\r' || cc == '\v'; cc = ap.currentCharacter() {
+		ap.iterateCharacter()
+	}
+}
+
+// stripComments - removes comments and literals from src.
+func stripComments(src string) string {
+	sb := strings.Builder{}
+
+	for i := 0; i < len(src); {
+		switch end := literalAt(src, i); {
+		case end >= 0:
+			i = end
+		case src[i] == ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		default:
+			sb.WriteByte(src[i])
+			i++
+		}
+	}
+
+	return sb.String()
+}
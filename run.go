@@ -0,0 +1,187 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrOutOfFuel - returned when machine used all ticks allowed by RunOptions.MaxTicks.
+var ErrOutOfFuel = errors.New("out of fuel")
+
+// StopReason - describes why RunContext returned.
+type StopReason uint8
+
+const (
+	// StopEnd - code pointer reached end of code.
+	StopEnd StopReason = iota
+
+	// StopHalt - program stored its exit status to halt word.
+	StopHalt
+
+	// StopFuel - tick budget is exhausted.
+	StopFuel
+
+	// StopCanceled - context was canceled or its deadline exceeded.
+	StopCanceled
+
+	// StopFault - instruction faulted.
+	StopFault
+
+	// StopStep - debugger executed requested number of ticks.
+	StopStep
+
+	// StopBreakpoint - debugger reached breakpoint.
+	StopBreakpoint
+
+	// StopWatchpoint - debugger caught watched data access.
+	StopWatchpoint
+
+	// StopHistory - debugger reached start of recorded history.
+	StopHistory
+
+	// StopTrace - tracer failed to record tick.
+	StopTrace
+)
+
+// pollInterval - number of ticks between context checks.
+const pollInterval = 1 << 10
+
+// RunOptions - limits for RunContext.
+type RunOptions struct {
+	// MaxTicks - maximum number of ticks to execute. Zero means no limit.
+	MaxTicks uint64
+
+	// Fuse - executes straight-line sequences of instructions as superinstructions.
+	// It is used only if every block of mutex table is owned by machine, not shared and readable and writable,
+	// and Tracer is nil.
+	Fuse bool
+
+	// Tracer - receives record of every tick.
+	Tracer Tracer
+}
+
+// RunResult - number of executed ticks, reason of stop and exit status of halted machine.
+type RunResult struct {
+	Ticks  uint64
+	Reason StopReason
+	Status Word
+}
+
+// RunContext - executes code like Run, but stops when ctx is done or tick budget is exhausted.
+// Stopped by budget or context machine returns to StateReady and may be resumed by calling RunContext again.
+// Halted or faulted machine is not executed, its previous result is returned instead.
+// Instruction blocked by MF can not be interrupted.
+func (mac *Machine) RunContext(ctx context.Context, opts RunOptions) (res RunResult, err error) {
+	if res, err, ok := mac.finished(); ok {
+		return res, err
+	}
+
+	mac.setState(StateRunning)
+
+	done := ctx.Done()
+	shared := mac.shared()
+	poll := uint64(0)
+
+	var sup []*superinst
+	if opts.Fuse && !shared && !mac.restricted() && opts.Tracer == nil {
+		sup = mac.superprogram()
+	}
+
+	for mac.codP != Word(len(mac.code)) {
+		if opts.MaxTicks != 0 && res.Ticks >= opts.MaxTicks {
+			mac.setState(StateReady)
+			res.Reason = StopFuel
+			return res, ErrOutOfFuel
+		}
+
+		if done != nil && res.Ticks >= poll {
+			poll = res.Ticks + pollInterval
+
+			select {
+			case <-done:
+				mac.setState(StateReady)
+				res.Reason = StopCanceled
+				return res, ctx.Err()
+			default:
+			}
+		}
+
+		if sup != nil && mac.codP >= 0 && mac.codP < Word(len(sup)) {
+			if s := sup[mac.codP]; s != nil &&
+				(opts.MaxTicks == 0 || opts.MaxTicks-res.Ticks >= uint64(s.n)) &&
+				mac.execFused(s) {
+				res.Ticks += uint64(s.n)
+				continue
+			}
+		}
+
+		var reason StopReason
+		if opts.Tracer != nil {
+			reason, err = mac.traced(shared, opts.Tracer, res.Ticks)
+		} else {
+			reason, err = mac.advance(shared)
+		}
+
+		if reason != StopFault {
+			res.Ticks++
+		}
+
+		if reason != StopStep {
+			res.Reason = reason
+			res.Status = mac.status
+			return res, err
+		}
+	}
+
+	mac.halt(StopEnd, 0)
+	res.Reason = StopEnd
+	return res, nil
+}
+
+// finished - returns previous result of halted or faulted machine.
+func (mac *Machine) finished() (RunResult, error, bool) {
+	switch mac.State() {
+	case StateHalted:
+		return RunResult{Reason: mac.stop, Status: mac.status}, nil, true
+	case StateFaulted:
+		return RunResult{Reason: StopFault}, mac.err, true
+	}
+
+	return RunResult{}, nil, false
+}
+
+// advance - executes single checked instruction and moves machine to halted or faulted state if needed.
+// Returns StopStep if machine can continue.
+func (mac *Machine) advance(shared bool) (StopReason, error) {
+	if err := mac.step(shared); err != nil {
+		mac.err = err
+		mac.stop = StopFault
+		mac.setState(StateFaulted)
+		return StopFault, err
+	}
+
+	if mac.State() == StateHalted {
+		return mac.stop, nil
+	}
+
+	if mac.codP == Word(len(mac.code)) {
+		mac.halt(StopEnd, 0)
+		return StopEnd, nil
+	}
+
+	return StopStep, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachineRunContext(t *testing.T) {
+	ctxC, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ctxD, cancelD := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelD()
+
+	tests := []struct {
+		name string
+		mac  *Machine
+		ctx  context.Context
+		opts RunOptions
+		expt RunResult
+		err  error
+	}{
+		{
+			name: "end of code",
+			mac:  NewMachine([]Code{VJ | EF}, []Word{2, 3}, new(MutexTab)),
+			ctx:  context.Background(),
+			expt: RunResult{Ticks: 1, Reason: StopEnd},
+		},
+		{
+			name: "fuel",
+			mac:  NewMachine([]Code{CJ | IF}, []Word{0}, new(MutexTab)),
+			ctx:  context.Background(),
+			opts: RunOptions{MaxTicks: 100},
+			expt: RunResult{Ticks: 100, Reason: StopFuel},
+			err:  ErrOutOfFuel,
+		},
+		{
+			name: "canceled",
+			mac:  NewMachine([]Code{CJ | IF}, []Word{0}, new(MutexTab)),
+			ctx:  ctxC,
+			expt: RunResult{Reason: StopCanceled},
+			err:  context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := test.mac.RunContext(test.ctx, test.opts)
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.expt, res)
+		})
+	}
+
+	t.Run("deadline", func(t *testing.T) {
+		res, err := NewMachine([]Code{CJ | IF}, []Word{0}, new(MutexTab)).RunContext(ctxD, RunOptions{})
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Equal(t, StopCanceled, res.Reason)
+		assert.NotZero(t, res.Ticks)
+	})
+}
@@ -0,0 +1,254 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+// Snapshot format:
+//
+//	magic "MABS", version byte
+//	state byte, stop reason byte
+//	codP, srcP, dstP, haltP, status as varints
+//	fault kind byte, fault op byte, fault codP, srcP, dstP as varints (only in StateFaulted)
+//	code length as uvarint, code bytes
+//	data length as uvarint, data words as 8-byte little-endian
+//	block size as uvarint, grow word as varint, maximum number of data blocks as uvarint
+//	block count as uvarint, block owners as uvarints followed by block flags bytes
+//
+// Block owner is 0 for unowned block, 1 for machine itself
+// and n+2 for n-th foreign owner in order of first appearance.
+// Block flags byte contains permissions in low bits and shared flag in bit 7.
+const (
+	snapshotMagic   = "MABS"
+	snapshotVersion = 1
+
+	snapshotShared = 1 << 7
+)
+
+var (
+	ErrSnapshotFormat  = errors.New("invalid snapshot format")
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+)
+
+// Snapshot - encodes code, data, pointers, lifecycle state and block ownership of machine.
+// It must not be called while machine is running.
+func (mac *Machine) Snapshot() []byte {
+	b := append([]byte(snapshotMagic), snapshotVersion, byte(mac.State()), byte(mac.stop))
+
+	b = binary.AppendVarint(b, mac.codP)
+	b = binary.AppendVarint(b, mac.srcP)
+	b = binary.AppendVarint(b, mac.dstP)
+	b = binary.AppendVarint(b, mac.haltP)
+	b = binary.AppendVarint(b, mac.status)
+
+	if mac.State() == StateFaulted {
+		f := new(Fault)
+		errors.As(mac.err, &f)
+
+		b = append(b, byte(f.Kind), f.Op)
+		b = binary.AppendVarint(b, f.CodP)
+		b = binary.AppendVarint(b, f.SrcP)
+		b = binary.AppendVarint(b, f.DstP)
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(mac.code)))
+	b = append(b, mac.code...)
+
+	b = binary.AppendUvarint(b, uint64(mac.words()))
+	for i := Word(0); i < mac.words(); i++ {
+		b = binary.LittleEndian.AppendUint64(b, uint64(mac.load(i, false)))
+	}
+
+	b = binary.AppendUvarint(b, uint64(mac.geom.size()))
+	b = binary.AppendVarint(b, mac.growP)
+	b = binary.AppendUvarint(b, uint64(mac.maxBlocks))
+
+	if mac.mtab == nil {
+		return binary.AppendUvarint(b, 0)
+	}
+
+	tab := mac.mtab.Blocks()
+	b = binary.AppendUvarint(b, uint64(len(tab)))
+
+	owners := map[*sync.RWMutex]uint64{nil: 0, &mac.RWMutex: 1}
+	for _, blk := range tab {
+		id, ok := owners[blk.Owner]
+		if !ok {
+			id = uint64(len(owners))
+			owners[blk.Owner] = id
+		}
+
+		flags := byte(blk.Perm)
+		if blk.Shared {
+			flags |= snapshotShared
+		}
+
+		b = append(binary.AppendUvarint(b, id), flags)
+	}
+
+	return b
+}
+
+// RestoreMachine - decodes snapshot into new machine with new mutex table.
+// Memory for growth of data is not reserved, SetMaxBlocks reserves it.
+// Blocks of n-th foreign owner are bound to owners[n], blocks of missing owners are left unowned.
+func RestoreMachine(snap []byte, owners ...*sync.RWMutex) (*Machine, error) {
+	if !bytes.HasPrefix(snap, []byte(snapshotMagic)) || len(snap) < len(snapshotMagic)+3 {
+		return nil, ErrSnapshotFormat
+	}
+
+	if snap[len(snapshotMagic)] != snapshotVersion {
+		return nil, ErrSnapshotVersion
+	}
+
+	r := bytes.NewReader(snap[len(snapshotMagic)+1:])
+	sr := varintReader{r: r}
+
+	state := State(sr.byte())
+	stop := StopReason(sr.byte())
+
+	mac := &Machine{
+		codP:  sr.varint(),
+		srcP:  sr.varint(),
+		dstP:  sr.varint(),
+		haltP: sr.varint(),
+	}
+	mac.status = sr.varint()
+	mac.stop = stop
+	mac.state.Store(uint32(state))
+
+	if state == StateFaulted {
+		mac.err = &Fault{
+			Kind: FaultKind(sr.byte()),
+			Op:   sr.byte(),
+			CodP: sr.varint(),
+			SrcP: sr.varint(),
+			DstP: sr.varint(),
+		}
+	}
+
+	mac.code = make([]Code, sr.length(1, r.Len()))
+	sr.read(mac.code)
+
+	mac.data = make([]Word, sr.length(8, r.Len()))
+	for i := range mac.data {
+		var w [8]byte
+		sr.read(w[:])
+		mac.data[i] = Word(binary.LittleEndian.Uint64(w[:]))
+	}
+
+	blockSize := Word(sr.uvarint())
+	mac.growP = sr.varint()
+
+	maxBlocks := sr.uvarint()
+	if maxBlocks > math.MaxInt32 {
+		return nil, ErrSnapshotFormat
+	}
+
+	mtab, err := NewMutexTab(blockSize)
+	if err != nil {
+		return nil, ErrSnapshotFormat
+	}
+
+	mac.mtab = mtab
+	mac.geom = Geometry{BlockSize: blockSize}
+	mac.geom.Blocks = mac.geom.cover(len(mac.data))
+	mac.maxBlocks = max(mac.geom.Blocks, int(maxBlocks))
+
+	tab := make([]Block, sr.length(1, r.Len()))
+	for i := range tab {
+		blk := &tab[i]
+
+		id := sr.uvarint()
+		switch {
+		case id == 1:
+			blk.Owner = &mac.RWMutex
+		case id > 1 && id-2 < uint64(len(owners)):
+			blk.Owner = owners[id-2]
+		}
+
+		flags := sr.byte()
+		blk.Perm, blk.Shared = Perm(flags&^snapshotShared), flags&snapshotShared != 0
+	}
+
+	if sr.err != nil || r.Len() != 0 {
+		return nil, ErrSnapshotFormat
+	}
+
+	mac.mtab.SetBlocks(tab)
+
+	return mac, nil
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// varintReader - remembers first decoding error, so fields can be read without checks.
+type varintReader struct {
+	r   byteReader
+	err error
+}
+
+func (sr *varintReader) byte() byte {
+	b, err := sr.r.ReadByte()
+	sr.fail(err)
+
+	return b
+}
+
+func (sr *varintReader) varint() Word {
+	v, err := binary.ReadVarint(sr.r)
+	sr.fail(err)
+
+	return v
+}
+
+func (sr *varintReader) uvarint() uint64 {
+	v, err := binary.ReadUvarint(sr.r)
+	sr.fail(err)
+
+	return v
+}
+
+// length - reads length of sequence of elements with given size, which must fit in rest of input.
+func (sr *varintReader) length(size int, rest int) int {
+	n := sr.uvarint()
+	if n > uint64(rest/size) {
+		sr.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+
+	return int(n)
+}
+
+func (sr *varintReader) read(b []byte) {
+	_, err := io.ReadFull(sr.r, b)
+	sr.fail(err)
+}
+
+func (sr *varintReader) fail(err error) {
+	if sr.err == nil {
+		sr.err = err
+	}
+}
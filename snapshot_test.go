@@ -0,0 +1,116 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachineSnapshot(t *testing.T) {
+	mac := newDebugMachine()
+	mac.SetHaltWord(3)
+
+	var dev sync.RWMutex
+	mac.mtab.SetBlocks(append(mac.mtab.Blocks(), Block{Owner: &dev, Perm: PermRW, Shared: true}))
+
+	_, err := mac.RunContext(context.Background(), RunOptions{MaxTicks: 2})
+	assert.Equal(t, ErrOutOfFuel, err)
+
+	res, err := RestoreMachine(mac.Snapshot(), &dev)
+	assert.Nil(t, err)
+
+	assert.Equal(t, mac.code, res.code)
+	assert.Equal(t, mac.data, res.data)
+	assert.Equal(t, [4]Word{2, 5, 2, 3}, [4]Word{res.codP, res.srcP, res.dstP, res.haltP})
+	assert.Equal(t, StateReady, res.State())
+	assert.Len(t, res.mtab.Blocks(), 2)
+	assert.Same(t, &res.RWMutex, res.mtab.Blocks()[0].Owner)
+	assert.Same(t, &dev, res.mtab.Blocks()[1].Owner)
+	assert.Equal(t, Block{Owner: &dev, Perm: PermRW, Shared: true}, res.mtab.Blocks()[1])
+
+	status, err := res.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, Word(2), status)
+	assert.Equal(t, []Word{5, 4, 3, 2, 1, 2, 3, 4}, res.data)
+}
+
+func TestMachineSnapshotFault(t *testing.T) {
+	mac := NewMachine([]Code{SJ, VJ}, []Word{0}, new(MutexTab))
+	_, err := mac.Run()
+
+	res, rerr := RestoreMachine(mac.Snapshot())
+	assert.Nil(t, rerr)
+	assert.Equal(t, StateFaulted, res.State())
+	assert.Len(t, res.mtab.Blocks(), 1)
+	assert.Same(t, &res.RWMutex, res.mtab.Blocks()[0].Owner)
+
+	_, err2 := res.Run()
+	assert.Equal(t, err, err2)
+}
+
+func TestMachineSnapshotPermissions(t *testing.T) {
+	mac := NewMachine([]Code{VJ}, []Word{0, 1}, new(MutexTab))
+	mac.mtab.Protect(0, 1, PermRead)
+
+	res, err := RestoreMachine(mac.Snapshot())
+	assert.Nil(t, err)
+	assert.Equal(t, Block{Owner: &res.RWMutex, Perm: PermRead}, res.mtab.Blocks()[0])
+
+	_, err = res.Run()
+	assert.True(t, errors.Is(err, ErrProtection))
+}
+
+func TestRestoreMachineError(t *testing.T) {
+	snap := newDebugMachine().Snapshot()
+
+	tests := []struct {
+		name string
+		snap []byte
+		expt error
+	}{
+		{
+			name: "bad magic",
+			snap: []byte("MABX\x01"),
+			expt: ErrSnapshotFormat,
+		},
+		{
+			name: "bad version",
+			snap: append([]byte("MABS\x02"), snap[5:]...),
+			expt: ErrSnapshotVersion,
+		},
+		{
+			name: "truncated",
+			snap: snap[:len(snap)-3],
+			expt: ErrSnapshotFormat,
+		},
+		{
+			name: "trailing bytes",
+			snap: append(snap[:len(snap):len(snap)], 0),
+			expt: ErrSnapshotFormat,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := RestoreMachine(test.snap)
+			assert.Equal(t, test.expt, err)
+		})
+	}
+}
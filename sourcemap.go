@@ -0,0 +1,201 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"errors"
+	"strconv"
+)
+
+// SourceLoc - location of assembly item.
+// Line is 1-based, it is zero for unknown location.
+type SourceLoc struct {
+	File string
+	Line int
+}
+
+func (l SourceLoc) String() string {
+	if l.File == "" {
+		return "line " + strconv.Itoa(l.Line)
+	}
+
+	return l.File + ":" + strconv.Itoa(l.Line)
+}
+
+// SourceLabel - label with code and data indices at its definition.
+type SourceLabel struct {
+	Name string
+	Code Word
+	Data Word
+}
+
+// SourceMap - maps code and data indices back to assembly source.
+// Code[i] and Data[j] are locations of items, which emitted code[i] and data[j].
+// Labels are in order of definition.
+type SourceMap struct {
+	Code   []SourceLoc
+	Data   []SourceLoc
+	Labels []SourceLabel
+}
+
+// CodeLoc - returns location of instruction i or zero location.
+func (sm *SourceMap) CodeLoc(i Word) SourceLoc {
+	if sm == nil || i < 0 || i >= Word(len(sm.Code)) {
+		return SourceLoc{}
+	}
+
+	return sm.Code[i]
+}
+
+// DataLoc - returns location of data word j or zero location.
+func (sm *SourceMap) DataLoc(j Word) SourceLoc {
+	if sm == nil || j < 0 || j >= Word(len(sm.Data)) {
+		return SourceLoc{}
+	}
+
+	return sm.Data[j]
+}
+
+// CodeSymbol - returns nearest label at or before instruction i as "name" or "name+offset".
+// It returns empty string if there is no such label.
+func (sm *SourceMap) CodeSymbol(i Word) string {
+	return sm.symbol(i, false)
+}
+
+// DataSymbol - returns nearest label at or before data word j like CodeSymbol.
+func (sm *SourceMap) DataSymbol(j Word) string {
+	return sm.symbol(j, true)
+}
+
+// symbol - returns nearest label, preferring label defined later among labels at the same index.
+func (sm *SourceMap) symbol(p Word, data bool) string {
+	if sm == nil || p < 0 {
+		return ""
+	}
+
+	best := -1
+	bestP := Word(-1)
+
+	for i, l := range sm.Labels {
+		lp := l.Code
+		if data {
+			lp = l.Data
+		}
+
+		if lp <= p && lp >= bestP {
+			best, bestP = i, lp
+		}
+	}
+
+	if best < 0 {
+		return ""
+	}
+
+	if p == bestP {
+		return sm.Labels[best].Name
+	}
+
+	return sm.Labels[best].Name + "+" + strconv.FormatInt(p-bestP, 10)
+}
+
+// CodeSource - describes instruction i as "location symbol", omitting unknown parts.
+func (sm *SourceMap) CodeSource(i Word) string {
+	return describe(sm.CodeLoc(i), sm.CodeSymbol(i))
+}
+
+// DataSource - describes data word j like CodeSource.
+func (sm *SourceMap) DataSource(j Word) string {
+	return describe(sm.DataLoc(j), sm.DataSymbol(j))
+}
+
+func describe(loc SourceLoc, sym string) string {
+	switch {
+	case loc.Line == 0:
+		return sym
+	case sym == "":
+		return loc.String()
+	}
+
+	return loc.String() + " " + sym
+}
+
+// source - returns description in parentheses prefixed with space or empty string.
+func source(src string) string {
+	if src == "" {
+		return ""
+	}
+
+	return " (" + src + ")"
+}
+
+// LineCode - returns indices of instructions emitted by line of file.
+func (sm *SourceMap) LineCode(file string, line int) []Word {
+	if sm == nil {
+		return nil
+	}
+
+	var codes []Word
+
+	for i, l := range sm.Code {
+		if l.File == file && l.Line == line {
+			codes = append(codes, Word(i))
+		}
+	}
+
+	return codes
+}
+
+var ErrNoSourceMap = errors.New("machine has no source map")
+
+// SetSourceMap - attaches source map, which is used to describe pointers in dumps, faults, traces and debugger.
+func (mac *Machine) SetSourceMap(sm *SourceMap) {
+	mac.smap = sm
+}
+
+func (mac *Machine) SourceMap() *SourceMap {
+	return mac.smap
+}
+
+// SourceMap - returns source map of parsed source.
+func (ap *AsmParser) SourceMap() *SourceMap {
+	st := ap.state()
+
+	if st.smap == nil {
+		st.smap = &SourceMap{}
+	}
+
+	st.smap.Labels = st.smap.Labels[:0]
+
+	for _, name := range st.order {
+		l := st.labels[name]
+		st.smap.Labels = append(st.smap.Labels, SourceLabel{Name: name, Code: l.code, Data: l.data})
+	}
+
+	return st.smap
+}
+
+// record - maps code and data emitted by current item to its location.
+func (ap *AsmParser) record(mac *Machine) {
+	sm := ap.st.smap
+	loc := SourceLoc{File: ap.file, Line: ap.lineAt(ap.start) + 1}
+
+	for len(sm.Code) < len(mac.code) {
+		sm.Code = append(sm.Code, loc)
+	}
+
+	for len(sm.Data) < len(mac.data) {
+		sm.Data = append(sm.Data, loc)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSourceMachine(t *testing.T) *Machine {
+	ap, err := NewAsmParserFS(fstest.MapFS{
+		"main.asm": {Data: []byte(".include \"lib.asm\"\n\t+d1 +d2\nbuf:\n\t+d0#2\nstart:\n\t:V'E\nloop:\n\ttwice\n")},
+		"lib.asm":  {Data: []byte(".macro twice\n\t:S\n\t:S\n.endm\n")},
+	}, "main.asm")
+	assert.Equal(t, nil, err)
+
+	src := &Machine{}
+	assert.Equal(t, nil, ap.Parse(src))
+
+	mac := NewMachine(src.code, src.data, new(MutexTab))
+	mac.SetSourceMap(ap.SourceMap())
+
+	return mac
+}
+
+func TestAsmParserSourceMap(t *testing.T) {
+	sm := newSourceMachine(t).SourceMap()
+
+	main := func(line int) SourceLoc { return SourceLoc{File: "main.asm", Line: line} }
+	lib := func(line int) SourceLoc { return SourceLoc{File: "lib.asm", Line: line} }
+
+	assert.Equal(t, &SourceMap{
+		Code: []SourceLoc{main(6), lib(2), lib(3)},
+		Data: []SourceLoc{main(2), main(2), main(4), main(4)},
+		Labels: []SourceLabel{
+			{Name: "buf", Code: 0, Data: 2},
+			{Name: "start", Code: 0, Data: 4},
+			{Name: "loop", Code: 1, Data: 4},
+		},
+	}, sm)
+
+	tests := []struct {
+		name   string
+		got    string
+		expect string
+	}{
+		{name: "code at labels", got: sm.CodeSource(0), expect: "main.asm:6 start"},
+		{name: "code in macro", got: sm.CodeSource(2), expect: "lib.asm:3 loop+1"},
+		{name: "code out of range", got: sm.CodeSource(-1), expect: ""},
+		{name: "data before labels", got: sm.DataSource(1), expect: "main.asm:2"},
+		{name: "data after label", got: sm.DataSource(3), expect: "main.asm:4 buf+1"},
+		{name: "data out of range", got: sm.DataSource(4), expect: "loop"},
+		{name: "nil map", got: (*SourceMap)(nil).CodeSource(0), expect: ""},
+		{name: "location without file", got: SourceLoc{Line: 3}.String(), expect: "line 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, tt.got)
+		})
+	}
+
+	assert.Empty(t, sm.LineCode("main.asm", 8))
+	assert.Equal(t, []Word{1}, sm.LineCode("lib.asm", 2))
+}
+
+func TestMachineSourceMap(t *testing.T) {
+	mac := newSourceMachine(t)
+	d := NewDebugger(mac)
+
+	assert.Equal(t, "codP 0 (main.asm:6 start), srcP 3 (main.asm:4 buf+1), dstP 0 (main.asm:2)", d.Where())
+
+	assert.Equal(t, ErrNoSourceMap, NewDebugger(newDebugMachine()).SetBreakpointAt("main.asm", 6))
+	assert.EqualError(t, d.SetBreakpointAt("main.asm", 5), "no code at main.asm:5")
+	assert.EqualError(t, d.SetBreakpointLabel("none"), `undefined label "none"`)
+	assert.Equal(t, nil, d.SetBreakpointAt("lib.asm", 3))
+
+	ev, err := d.Continue()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Event{Reason: StopBreakpoint, CodP: 2}, ev)
+
+	buf := bytes.NewBuffer(nil)
+	w := bufio.NewWriter(buf)
+	mac.Dump(w)
+	w.Flush()
+
+	assert.Contains(t, buf.String(), "SJ: Source Jump (lib.asm:2 loop)\n")
+	assert.Contains(t, buf.String(), "codP: Code Pointer: 2 (lib.asm:3 loop+1)\n")
+
+	d.SetCodP(0)
+	d.SetSrcP(-1)
+
+	_, err = d.Step()
+
+	var f *Fault
+	assert.ErrorAs(t, err, &f)
+	assert.Equal(t, "main.asm:6 start", f.Source)
+	assert.Equal(t, "", f.SrcSource)
+	assert.Equal(t, "main.asm:2", f.DstSource)
+	assert.Contains(t, err.Error(), " at main.asm:6 start, dstP at main.asm:2")
+
+	d.SetSrcP(2)
+	d.SetDstP(-1)
+
+	_, err = d.Step()
+
+	assert.ErrorAs(t, err, &f)
+	assert.Equal(t, "main.asm:4 buf", f.SrcSource)
+	assert.Equal(t, "", f.DstSource)
+	assert.Contains(t, err.Error(), " at main.asm:6 start, srcP at main.asm:4 buf")
+}
+
+func TestMachineSourceMapTrace(t *testing.T) {
+	mac := newSourceMachine(t)
+	buf := bytes.NewBuffer(nil)
+
+	_, err := mac.RunContext(context.Background(), RunOptions{MaxTicks: 2, Tracer: NewJSONTracer(buf)})
+	assert.ErrorIs(t, err, ErrOutOfFuel)
+
+	dec := json.NewDecoder(buf)
+
+	for _, expect := range [][3]string{
+		{"main.asm:6 start", "main.asm:4 buf+1", "main.asm:2"},
+		{"lib.asm:2 loop", "main.asm:2", "main.asm:2"},
+	} {
+		var ev TraceEvent
+		assert.Equal(t, nil, dec.Decode(&ev))
+		assert.Equal(t, expect, [3]string{ev.Source, ev.SrcSource, ev.DstSource})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+// State - lifecycle state of machine.
+type State uint32
+
+const (
+	// StateReady - machine is created or paused and can be run.
+	StateReady State = iota
+
+	// StateRunning - machine executes code.
+	StateRunning
+
+	// StateBlocked - machine sleeps on MF instruction.
+	StateBlocked
+
+	// StateHalted - machine reached end of code or stored to halt word.
+	StateHalted
+
+	// StateFaulted - machine stopped on fault.
+	StateFaulted
+)
+
+var stateNames = [...]string{
+	StateReady:   "ready",
+	StateRunning: "running",
+	StateBlocked: "blocked",
+	StateHalted:  "halted",
+	StateFaulted: "faulted",
+}
+
+func (s State) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+
+	return "unknown"
+}
+
+// State - returns current state of machine. It is safe to call from other goroutines.
+func (mac *Machine) State() State {
+	return State(mac.state.Load())
+}
+
+func (mac *Machine) setState(s State) State {
+	return State(mac.state.Swap(uint32(s)))
+}
+
+// SetHaltWord - sets index of halt word.
+// When VJ stores value to halt word, machine halts with this value as exit status.
+// Negative index disables halt word.
+func (mac *Machine) SetHaltWord(i Word) {
+	mac.haltP = i
+}
+
+// ExitStatus - returns value stored to halt word by halted machine.
+// It is zero if machine halted at end of code.
+func (mac *Machine) ExitStatus() Word {
+	return mac.status
+}
+
+func (mac *Machine) halt(reason StopReason, status Word) {
+	mac.stop = reason
+	mac.status = status
+	mac.setState(StateHalted)
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachineState(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   []Code
+		data   []Word
+		halt   Word
+		state  State
+		status Word
+		reason StopReason
+	}{
+		{
+			name:   "end of code",
+			code:   []Code{VJ | EF},
+			data:   []Word{2, 3},
+			halt:   -1,
+			state:  StateHalted,
+			reason: StopEnd,
+		},
+		{
+			name:   "halt word",
+			code:   []Code{DJ, VJ, CJ | IF},
+			data:   []Word{0, 0, 41},
+			halt:   1,
+			state:  StateHalted,
+			status: 42,
+			reason: StopHalt,
+		},
+		{
+			name:   "fault",
+			code:   []Code{SJ, VJ},
+			data:   []Word{0},
+			halt:   -1,
+			state:  StateFaulted,
+			reason: StopFault,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mac := NewMachine(test.code, test.data, new(MutexTab))
+			mac.SetHaltWord(test.halt)
+
+			assert.Equal(t, StateReady, mac.State())
+
+			res, err := mac.RunContext(context.Background(), RunOptions{})
+			assert.Equal(t, test.state, mac.State())
+			assert.Equal(t, test.reason, res.Reason)
+			assert.Equal(t, test.status, res.Status)
+			assert.Equal(t, test.status, mac.ExitStatus())
+
+			again, againErr := mac.RunContext(context.Background(), RunOptions{})
+			assert.Equal(t, err, againErr)
+			assert.Equal(t, test.reason, again.Reason)
+			assert.Equal(t, test.status, again.Status)
+		})
+	}
+}
+
+func TestMachineStateBlocked(t *testing.T) {
+	mac := NewMachine([]Code{VJ | MF}, []Word{0, 1}, new(MutexTab))
+
+	done := make(chan struct{})
+	go func() {
+		mac.Run()
+		close(done)
+	}()
+
+	for mac.State() != StateBlocked {
+		runtime.Gosched()
+	}
+
+	mac.Unlock()
+	<-done
+
+	assert.Equal(t, StateHalted, mac.State())
+	assert.Equal(t, []Word{2, 1}, mac.data)
+}
@@ -0,0 +1,5 @@
+.include "const.asm"
+.macro add k
+	\k
+	:V'E
+.endm
@@ -0,0 +1 @@
+.equ Three +d3
@@ -0,0 +1,4 @@
+; program assembled from several files
+.include "lib/add.asm"
+	add +d2
+	add (Three)
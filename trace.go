@@ -0,0 +1,306 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// TraceEvent - record of single tick.
+// CodP is code pointer before tick, DCod, DSrc and DDst are pointer changes made by tick.
+// Addr and Value are set only if tick wrote word.
+type TraceEvent struct {
+	Tick uint64 `json:"tick"`
+	Op   Code   `json:"op"`
+	CodP Word   `json:"codP"`
+
+	DCod Word `json:"dCod"`
+	DSrc Word `json:"dSrc,omitempty"`
+	DDst Word `json:"dDst,omitempty"`
+
+	Write bool `json:"write,omitempty"`
+	Addr  Word `json:"addr,omitempty"`
+	Value Word `json:"value,omitempty"`
+
+	// Source, SrcSource, DstSource - descriptions of code, source and destination pointers before tick
+	// from source map, they are not stored in binary trace.
+	Source    string `json:"source,omitempty"`
+	SrcSource string `json:"srcSource,omitempty"`
+	DstSource string `json:"dstSource,omitempty"`
+}
+
+// Tracer - receives record of every executed tick.
+type Tracer interface {
+	Trace(ev *TraceEvent) error
+}
+
+// beginTrace - records state before tick. It returns word which tick may write or -1.
+func (mac *Machine) beginTrace(tick uint64) (ev TraceEvent, write Word) {
+	_, write = mac.accesses()
+
+	ev = TraceEvent{
+		Tick: tick,
+		CodP: mac.codP,
+		DCod: mac.codP,
+		DSrc: mac.srcP,
+		DDst: mac.dstP,
+
+		Source:    mac.smap.CodeSource(mac.codP),
+		SrcSource: mac.smap.DataSource(mac.srcP),
+		DstSource: mac.smap.DataSource(mac.dstP),
+	}
+
+	if mac.codP >= 0 && mac.codP < Word(len(mac.code)) {
+		ev.Op = mac.code[mac.codP]
+	}
+
+	return
+}
+
+// endTrace - completes event after tick.
+func (mac *Machine) endTrace(ev *TraceEvent, write Word) {
+	ev.DCod = mac.codP - ev.DCod
+	ev.DSrc = mac.srcP - ev.DSrc
+	ev.DDst = mac.dstP - ev.DDst
+
+	if write >= 0 && ev.DCod != 0 {
+		ev.Write = true
+		ev.Addr = write
+		ev.Value = mac.load(write, false)
+	}
+}
+
+// traced - executes checked instruction like advance and reports it to tracer.
+func (mac *Machine) traced(shared bool, tr Tracer, tick uint64) (StopReason, error) {
+	ev, write := mac.beginTrace(tick)
+
+	reason, err := mac.advance(shared)
+	if reason == StopFault {
+		return reason, err
+	}
+
+	mac.endTrace(&ev, write)
+
+	if err := tr.Trace(&ev); err != nil {
+		if reason == StopStep {
+			mac.setState(StateReady)
+		}
+
+		return StopTrace, err
+	}
+
+	return reason, nil
+}
+
+// JSONTracer - writes trace as JSON Lines.
+type JSONTracer struct {
+	enc *json.Encoder
+}
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *JSONTracer) Trace(ev *TraceEvent) error {
+	return t.enc.Encode(ev)
+}
+
+// Binary trace format:
+//
+//	magic "MABT", version byte
+//	events: flags byte, op byte, then fields selected by flags
+//
+// Tick and code pointer are encoded as differences from expected values,
+// which are next tick and code pointer after previous event.
+const (
+	traceMagic   = "MABT"
+	traceVersion = 1
+)
+
+const (
+	traceTick  = 1 << iota // uvarint tick - expected tick
+	traceCodP              // varint codP - expected codP
+	traceDCod              // varint dCod, otherwise dCod = 1
+	traceDSrc              // varint dSrc
+	traceDDst              // varint dDst
+	traceWrite             // varint addr, varint value
+)
+
+var ErrTraceFormat = errors.New("invalid trace format")
+
+// BinaryTracer - writes compact binary trace.
+type BinaryTracer struct {
+	w   io.Writer
+	buf []byte
+
+	tick uint64
+	codP Word
+}
+
+func NewBinaryTracer(w io.Writer) *BinaryTracer {
+	return &BinaryTracer{w: w, buf: append([]byte(traceMagic), traceVersion)}
+}
+
+func (t *BinaryTracer) Trace(ev *TraceEvent) error {
+	b := append(t.buf, 0, ev.Op)
+	flags := byte(0)
+
+	if ev.Tick != t.tick {
+		flags |= traceTick
+		b = binary.AppendUvarint(b, ev.Tick-t.tick)
+	}
+
+	if ev.CodP != t.codP {
+		flags |= traceCodP
+		b = binary.AppendVarint(b, ev.CodP-t.codP)
+	}
+
+	if ev.DCod != 1 {
+		flags |= traceDCod
+		b = binary.AppendVarint(b, ev.DCod)
+	}
+
+	if ev.DSrc != 0 {
+		flags |= traceDSrc
+		b = binary.AppendVarint(b, ev.DSrc)
+	}
+
+	if ev.DDst != 0 {
+		flags |= traceDDst
+		b = binary.AppendVarint(b, ev.DDst)
+	}
+
+	if ev.Write {
+		flags |= traceWrite
+		b = binary.AppendVarint(b, ev.Addr)
+		b = binary.AppendVarint(b, ev.Value)
+	}
+
+	b[len(t.buf)] = flags
+
+	t.tick = ev.Tick + 1
+	t.codP = ev.CodP + ev.DCod
+	t.buf = t.buf[:0]
+
+	_, err := t.w.Write(b)
+	return err
+}
+
+// TraceReader - decodes trace written by JSONTracer or BinaryTracer.
+// Format is detected by first bytes of trace.
+type TraceReader struct {
+	r *bufio.Reader
+
+	json   *json.Decoder
+	binary bool
+
+	tick uint64
+	codP Word
+}
+
+func NewTraceReader(r io.Reader) *TraceReader {
+	return &TraceReader{r: bufio.NewReader(r)}
+}
+
+// Next - returns next event of trace or io.EOF.
+func (tr *TraceReader) Next() (ev TraceEvent, err error) {
+	if tr.json == nil && !tr.binary {
+		if err = tr.detect(); err != nil {
+			return
+		}
+	}
+
+	if tr.json != nil {
+		err = tr.json.Decode(&ev)
+		return
+	}
+
+	return tr.nextBinary()
+}
+
+func (tr *TraceReader) detect() error {
+	head, err := tr.r.Peek(len(traceMagic) + 1)
+	if !bytes.HasPrefix(head, []byte(traceMagic)) {
+		tr.json = json.NewDecoder(tr.r)
+		return nil
+	}
+
+	if err != nil {
+		return ErrTraceFormat
+	}
+
+	if head[len(traceMagic)] != traceVersion {
+		return ErrTraceFormat
+	}
+
+	tr.binary = true
+	tr.r.Discard(len(head))
+
+	return nil
+}
+
+func (tr *TraceReader) nextBinary() (ev TraceEvent, err error) {
+	flags, err := tr.r.ReadByte()
+	if err != nil {
+		return
+	}
+
+	sr := varintReader{r: tr.r}
+
+	ev.Op = sr.byte()
+	ev.Tick = tr.tick
+	ev.CodP = tr.codP
+	ev.DCod = 1
+
+	if flags&traceTick != 0 {
+		ev.Tick += sr.uvarint()
+	}
+
+	if flags&traceCodP != 0 {
+		ev.CodP += sr.varint()
+	}
+
+	if flags&traceDCod != 0 {
+		ev.DCod = sr.varint()
+	}
+
+	if flags&traceDSrc != 0 {
+		ev.DSrc = sr.varint()
+	}
+
+	if flags&traceDDst != 0 {
+		ev.DDst = sr.varint()
+	}
+
+	if flags&traceWrite != 0 {
+		ev.Write = true
+		ev.Addr = sr.varint()
+		ev.Value = sr.varint()
+	}
+
+	if sr.err != nil {
+		return ev, ErrTraceFormat
+	}
+
+	tr.tick = ev.Tick + 1
+	tr.codP = ev.CodP + ev.DCod
+
+	return ev, nil
+}
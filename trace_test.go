@@ -0,0 +1,136 @@
+// Copyright 2022 Mark Mandriota
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mabvm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sliceTracer []TraceEvent
+
+func (t *sliceTracer) Trace(ev *TraceEvent) error {
+	*t = append(*t, *ev)
+	return nil
+}
+
+type multiTracer []Tracer
+
+func (t multiTracer) Trace(ev *TraceEvent) error {
+	for _, tr := range t {
+		if err := tr.Trace(ev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readTrace(t *testing.T, r io.Reader) (evs []TraceEvent) {
+	tr := NewTraceReader(r)
+
+	for {
+		ev, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+
+		assert.Nil(t, err)
+		evs = append(evs, ev)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	mac := NewMachine(
+		[]Code{DJ | EF, VJ, VJ | EF | IF, SJ | IF, DJ},
+		[]Word{0, 0, 0, 0, 1, 0, 7, 3},
+		new(MutexTab),
+	)
+
+	var evs sliceTracer
+	jsonBuf, binBuf := new(bytes.Buffer), new(bytes.Buffer)
+
+	_, err := mac.RunContext(context.Background(), RunOptions{
+		Tracer: multiTracer{&evs, NewJSONTracer(jsonBuf), NewBinaryTracer(binBuf)},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, sliceTracer{
+		{Tick: 0, Op: DJ | EF, CodP: 0, DCod: 1, DSrc: -1, DDst: 3},
+		{Tick: 1, Op: VJ, CodP: 1, DCod: 1, DSrc: -1, DDst: 1, Write: true, Addr: 3, Value: 8},
+		{Tick: 2, Op: VJ | EF | IF, CodP: 2, DCod: 1, DSrc: -2, DDst: 1, Write: true, Addr: 4, Value: 1},
+		{Tick: 3, Op: SJ | IF, CodP: 3, DCod: 1, DSrc: -1},
+		{Tick: 4, Op: DJ, CodP: 4, DCod: 1, DDst: 1},
+	}, evs)
+
+	assert.Equal(t, []TraceEvent(evs), readTrace(t, jsonBuf))
+	assert.Equal(t, []TraceEvent(evs), readTrace(t, binBuf))
+}
+
+func TestTraceBinaryGaps(t *testing.T) {
+	evs := []TraceEvent{
+		{Tick: 5, Op: CJ | EF, CodP: 9, DCod: -4, DSrc: -1},
+		{Tick: 9, Op: VJ, CodP: 2, DCod: 1, DSrc: -1, DDst: 1, Write: true, Addr: -3, Value: -1 << 63},
+	}
+
+	buf := new(bytes.Buffer)
+	tr := NewBinaryTracer(buf)
+
+	for i := range evs {
+		assert.Nil(t, tr.Trace(&evs[i]))
+	}
+
+	assert.Equal(t, evs, readTrace(t, buf))
+
+	_, err := NewTraceReader(strings.NewReader("MABT\x02")).Next()
+	assert.Equal(t, ErrTraceFormat, err)
+
+	_, err = NewTraceReader(strings.NewReader("MABT\x01\x20")).Next()
+	assert.Equal(t, ErrTraceFormat, err)
+}
+
+func TestDebugShow(t *testing.T) {
+	mac := NewMachine([]Code{VJ | EF}, []Word{2, 3}, new(MutexTab))
+
+	buf := new(bytes.Buffer)
+	mac.DebugShow(buf)
+
+	assert.Contains(t, buf.String(), `{"tick":0,"op":11,"codP":0,"dCod":1,"dSrc":-2,"dDst":1,"write":true,"value":5}`)
+	assert.Equal(t, 2, strings.Count(buf.String(), "Data:"))
+}
+
+func TestDebugShowHalt(t *testing.T) {
+	mac := NewMachine([]Code{DJ, VJ, CJ | IF}, []Word{0, 0, 41}, new(MutexTab))
+	mac.SetHaltWord(1)
+
+	buf := new(bytes.Buffer)
+	mac.DebugShow(buf)
+
+	assert.Equal(t, StateHalted, mac.State())
+	assert.Equal(t, Word(42), mac.ExitStatus())
+	assert.Equal(t, 2, strings.Count(buf.String(), `"tick"`))
+	assert.Equal(t, 2, strings.Count(buf.String(), "Data:"))
+
+	mac = NewMachine([]Code{VJ | EF}, []Word{2, 3}, new(MutexTab))
+	mac.DebugShow(new(bytes.Buffer))
+
+	assert.Equal(t, StateHalted, mac.State())
+	assert.Equal(t, Word(0), mac.ExitStatus())
+}
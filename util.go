@@ -35,10 +35,6 @@ func growSlice[E any](s []E, l int) []E {
 	return s[:l]
 }
 
-func byteOf[T any](v T) byte {
-	return *(*byte)(unsafe.Pointer(&v))
-}
-
 func byteSliceOf[E any](s []E) []byte {
 	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(s))),
 		uintptr(len(s))*unsafe.Sizeof(*new(E)))
@@ -72,3 +68,41 @@ func isVoid(b byte) bool {
 	return b == '\x00' || b == ' ' || b == '\n' ||
 		b == '\r' || b == '\t' || b == '\v'
 }
+
+func isIdentifierStart(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b == '_'
+}
+
+func baseOf(b byte) int64 {
+	switch b {
+	case 'b':
+		return 2
+	case 'o':
+		return 8
+	case 'd':
+		return 10
+	case 'h':
+		return 16
+	}
+
+	return 0
+}
+
+func isDigit(b byte) bool {
+	return digitOf(b) < 36
+}
+
+// digitOf - returns value of digit, letters of any case are digits from 10 to 35.
+// It returns 36 for other characters.
+func digitOf(b byte) int64 {
+	switch {
+	case b >= '0' && b <= '9':
+		return int64(b - '0')
+	case b >= 'A' && b <= 'Z':
+		return int64(b-'A') + 10
+	case b >= 'a' && b <= 'z':
+		return int64(b-'a') + 10
+	}
+
+	return 36
+}